@@ -0,0 +1,202 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"tfltt/tfl/client"
+	"tfltt/tfl/client/line"
+	"tfltt/tfl/client/stop_point"
+	"tfltt/tfl/models"
+)
+
+// boardRefreshSeconds is how often the departure board page reloads itself.
+const boardRefreshSeconds = 30
+
+// boardRows is the maximum number of arrivals shown for each platform.
+const boardRows = 8
+
+// BoardCSS styles the live departure board like a station dot-matrix
+// indicator.
+const BoardCSS = `body { background-color: #111; color: #ffb000; font-family: "Courier New", monospace; margin: 1em; }
+h1 { font-size: 1.4em; margin: 0 0 0.5em; }
+.board section { background-color: #000; border: 2px solid #333; border-radius: 4px; margin-bottom: 1em; padding: 6px 10px; }
+.board h2 { font-size: 1em; margin: 0 0 4px; color: #fff; text-transform: uppercase; }
+.board table { border-collapse: collapse; width: 100%; }
+.board td { padding: 2px 6px; white-space: nowrap; }
+.board td.order { width: 2em; }
+.board td.destination { width: 100%; white-space: normal; }
+.board td.due { text-align: right; }
+.board .location { color: #aa7700; font-size: 0.85em; }
+.board p.empty { margin: 0; }
+footer { color: #777; font-size: 0.8em; }
+`
+
+// platformArrivals is the predicted arrivals at one platform, soonest first.
+type platformArrivals struct {
+	platform    string
+	predictions []*models.TflAPIPresentationEntitiesPrediction
+}
+
+// predictionArrival returns when p is expected to arrive. Predictions without
+// an expected arrival time fall back to the time to station, measured from
+// the prediction's timestamp, or from now if that is missing too.
+func predictionArrival(p *models.TflAPIPresentationEntitiesPrediction, now time.Time) time.Time {
+	if t := time.Time(p.ExpectedArrival); !t.IsZero() {
+		return t
+	}
+	from := time.Time(p.Timestamp)
+	if from.IsZero() {
+		from = now
+	}
+	return from.Add(time.Duration(p.TimeToStation) * time.Second)
+}
+
+// groupArrivals groups predictions by platform, ordered by platform name,
+// with each platform's arrivals in order of expected arrival.
+func groupArrivals(predictions []*models.TflAPIPresentationEntitiesPrediction, now time.Time) []platformArrivals {
+	byPlatform := make(map[string][]*models.TflAPIPresentationEntitiesPrediction)
+	for _, p := range predictions {
+		byPlatform[p.PlatformName] = append(byPlatform[p.PlatformName], p)
+	}
+
+	var groups []platformArrivals
+	for platform, ps := range byPlatform {
+		slices.SortStableFunc(ps, func(a, b *models.TflAPIPresentationEntitiesPrediction) int {
+			return predictionArrival(a, now).Compare(predictionArrival(b, now))
+		})
+		groups = append(groups, platformArrivals{platform: platform, predictions: ps})
+	}
+	slices.SortFunc(groups, func(a, b platformArrivals) int {
+		return cmp.Compare(a.platform, b.platform)
+	})
+	return groups
+}
+
+// minutesToArrival describes how long until p arrives, as a station board
+// would: "due" within the next minute, otherwise whole minutes.
+func minutesToArrival(p *models.TflAPIPresentationEntitiesPrediction, now time.Time) string {
+	minutes := int(predictionArrival(p, now).Sub(now) / time.Minute)
+	if minutes < 1 {
+		return "due"
+	}
+	return fmt.Sprintf("%d min", minutes)
+}
+
+// boardPlatform is a platform's panel on the board.
+type boardPlatform struct {
+	Name     string
+	Arrivals []boardArrival
+}
+
+// boardArrival is a row of a platform's panel. Location is where the train
+// is now, if known.
+type boardArrival struct {
+	Order       int
+	Destination string
+	Location    string
+	Due         string
+}
+
+// boardPlatforms returns the arrivals, one panel per platform, as seen at
+// now, for the "board" partial.
+func boardPlatforms(groups []platformArrivals, now time.Time) []boardPlatform {
+	var platforms []boardPlatform
+	for _, g := range groups {
+		platform := boardPlatform{Name: g.platform}
+		if platform.Name == "" {
+			platform.Name = "Platform unknown"
+		}
+		for i, p := range g.predictions {
+			if i == boardRows {
+				break
+			}
+			destination := p.DestinationName
+			if destination == "" {
+				destination = p.Towards
+			}
+			platform.Arrivals = append(platform.Arrivals, boardArrival{
+				Order:       i + 1,
+				Destination: shortStationName(destination),
+				Location:    p.CurrentLocation,
+				Due:         minutesToArrival(p, now),
+			})
+		}
+		platforms = append(platforms, platform)
+	}
+	return platforms
+}
+
+// fetchArrivals returns the predicted arrivals at stopID, restricted to
+// lineID if it is not empty.
+func fetchArrivals(tflClient *client.Tfl, stopID, lineID string) ([]*models.TflAPIPresentationEntitiesPrediction, error) {
+	if lineID != "" {
+		params := line.NewLineArrivalsParams()
+		params.Ids = []string{lineID}
+		params.StopPointID = stopID
+		resp, err := tflClient.Line.LineArrivals(params)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Payload, nil
+	}
+	params := stop_point.NewStopPointArrivalsParams()
+	params.ID = stopID
+	resp, err := tflClient.StopPoint.StopPointArrivals(params)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload, nil
+}
+
+// boardPage is the data of the departure board page.
+type boardPage struct {
+	layoutData
+	StationName    string
+	Board          []boardPlatform
+	StreamURL      string
+	Updated        string
+	RefreshSeconds int
+}
+
+// BoardHandler serves a live departure board for a stop, optionally
+// restricted to one line. The page follows /board/stream, or refreshes itself
+// every boardRefreshSeconds without it.
+func BoardHandler(tflClient *client.Tfl) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stopID := r.URL.Query().Get("stop")
+		lineID := r.URL.Query().Get("line")
+
+		if stopID == "" {
+			http.Error(w, "Missing required parameter: stop", http.StatusBadRequest)
+			return
+		}
+
+		predictions, err := fetchArrivals(tflClient, stopID, lineID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error getting arrivals: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		now := time.Now()
+		if loc, err := time.LoadLocation("Europe/London"); err == nil {
+			now = now.In(loc)
+		}
+		stationName := stopID
+		if len(predictions) > 0 && predictions[0].StationName != "" {
+			stationName = predictions[0].StationName
+		}
+
+		renderPage(w, http.StatusOK, "board", boardPage{
+			layoutData:     layoutData{Title: stationName, CSS: BoardCSS},
+			StationName:    stationName,
+			Board:          boardPlatforms(groupArrivals(predictions, now), now),
+			StreamURL:      "/board/stream?" + r.URL.Query().Encode(),
+			Updated:        now.Format("15:04:05"),
+			RefreshSeconds: boardRefreshSeconds,
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"tfltt/tfl/models"
+)
+
+const (
+	// boardPollMin and boardPollMax bound the delay between upstream arrival
+	// requests for a stop. Within those bounds the poller waits until the
+	// first prediction's TimeToLive expires.
+	boardPollMin = 5 * time.Second
+	boardPollMax = 30 * time.Second
+)
+
+// boardUpdate is the result of one upstream arrivals request.
+type boardUpdate struct {
+	predictions []*models.TflAPIPresentationEntitiesPrediction
+	err         error
+}
+
+// stopPoller polls the arrivals at one stop while it has subscribers.
+type stopPoller struct {
+	subscribers map[chan boardUpdate]struct{}
+	latest      *boardUpdate
+	done        chan struct{}
+}
+
+// boardHub shares one upstream poller per stop between every viewer of that
+// stop's departure board stream.
+type boardHub struct {
+	fetch func(stopID string) ([]*models.TflAPIPresentationEntitiesPrediction, error)
+
+	mu      sync.Mutex
+	pollers map[string]*stopPoller
+}
+
+func newBoardHub(fetch func(stopID string) ([]*models.TflAPIPresentationEntitiesPrediction, error)) *boardHub {
+	return &boardHub{fetch: fetch, pollers: make(map[string]*stopPoller)}
+}
+
+// subscribe returns a channel receiving the arrivals at stopID each time they
+// are polled, starting with the latest poll if there is one. Call cancel to
+// unsubscribe; the stop's poller stops with its last subscriber.
+func (h *boardHub) subscribe(stopID string) (updates <-chan boardUpdate, cancel func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p, ok := h.pollers[stopID]
+	if !ok {
+		p = &stopPoller{subscribers: make(map[chan boardUpdate]struct{}), done: make(chan struct{})}
+		h.pollers[stopID] = p
+		go h.poll(stopID, p)
+	}
+	ch := make(chan boardUpdate, 1)
+	p.subscribers[ch] = struct{}{}
+	if p.latest != nil {
+		ch <- *p.latest
+	}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := p.subscribers[ch]; !ok {
+			return
+		}
+		delete(p.subscribers, ch)
+		if len(p.subscribers) == 0 {
+			delete(h.pollers, stopID)
+			close(p.done)
+		}
+	}
+}
+
+// polling reports whether a poller is running for stopID.
+func (h *boardHub) polling(stopID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.pollers[stopID]
+	return ok
+}
+
+// poll fetches the arrivals at stopID and sends them to p's subscribers
+// until p is done. Slow subscribers only ever see the newest update.
+func (h *boardHub) poll(stopID string, p *stopPoller) {
+	for {
+		predictions, err := h.fetch(stopID)
+		if err != nil {
+			log.Printf("Error getting arrivals for %s: %v", stopID, err)
+		}
+		update := boardUpdate{predictions: predictions, err: err}
+
+		h.mu.Lock()
+		p.latest = &update
+		for ch := range p.subscribers {
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- update
+		}
+		h.mu.Unlock()
+
+		timer := time.NewTimer(nextPollDelay(predictions, time.Now()))
+		select {
+		case <-p.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// nextPollDelay returns how long the predictions stay fresh: until the
+// earliest TimeToLive, clamped to between boardPollMin and boardPollMax.
+func nextPollDelay(predictions []*models.TflAPIPresentationEntitiesPrediction, now time.Time) time.Duration {
+	delay := boardPollMax
+	for _, p := range predictions {
+		ttl := time.Time(p.TimeToLive)
+		if ttl.IsZero() {
+			continue
+		}
+		delay = min(delay, ttl.Sub(now))
+	}
+	return max(delay, boardPollMin)
+}
+
+// writeBoardEvent writes update as a server-sent event: an "arrivals" event
+// carrying the rendered board, restricted to lineID if it is not empty, or
+// an "error" event.
+func writeBoardEvent(w http.ResponseWriter, update boardUpdate, lineID string, now time.Time) {
+	if update.err != nil {
+		fmt.Fprint(w, "event: error\ndata: Error getting arrivals\n\n")
+		return
+	}
+	predictions := update.predictions
+	if lineID != "" {
+		predictions = nil
+		for _, p := range update.predictions {
+			if p.LineID == lineID {
+				predictions = append(predictions, p)
+			}
+		}
+	}
+	board, err := renderPartial("board", boardPlatforms(groupArrivals(predictions, now), now))
+	if err != nil {
+		log.Printf("Error rendering board: %v", err)
+		fmt.Fprint(w, "event: error\ndata: Error rendering board\n\n")
+		return
+	}
+	fmt.Fprint(w, "event: arrivals\n")
+	for _, l := range strings.Split(board, "\n") {
+		fmt.Fprintf(w, "data: %s\n", l)
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// BoardStreamHandler streams a stop's departure board over server-sent
+// events, pushing a new board each time the stop's arrivals are polled.
+func BoardStreamHandler(hub *boardHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stopID := r.URL.Query().Get("stop")
+		lineID := r.URL.Query().Get("line")
+
+		if stopID == "" {
+			http.Error(w, "Missing required parameter: stop", http.StatusBadRequest)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		updates, cancel := hub.subscribe(stopID)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		fmt.Fprintf(w, "retry: %d\n\n", boardPollMin.Milliseconds())
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case update := <-updates:
+				writeBoardEvent(w, update, lineID, time.Now())
+				flusher.Flush()
+			}
+		}
+	}
+}
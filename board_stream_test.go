@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tfltt/tfl/models"
+
+	"github.com/go-openapi/strfmt"
+)
+
+func TestBoardHubSharesPoller(t *testing.T) {
+	var calls atomic.Int32
+	hub := newBoardHub(func(stopID string) ([]*models.TflAPIPresentationEntitiesPrediction, error) {
+		calls.Add(1)
+		return []*models.TflAPIPresentationEntitiesPrediction{{NaptanID: stopID}}, nil
+	})
+
+	first, cancelFirst := hub.subscribe("940GZZLUBST")
+	update := <-first
+	if len(update.predictions) != 1 || update.predictions[0].NaptanID != "940GZZLUBST" {
+		t.Fatalf("First subscriber got %+v", update)
+	}
+
+	// A second viewer gets the latest arrivals without another request.
+	second, cancelSecond := hub.subscribe("940GZZLUBST")
+	if update := <-second; len(update.predictions) != 1 {
+		t.Fatalf("Second subscriber got %+v", update)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Two viewers made %d upstream requests, want 1", got)
+	}
+
+	cancelFirst()
+	if !hub.polling("940GZZLUBST") {
+		t.Errorf("Poller stopped while a viewer remains")
+	}
+	cancelSecond()
+	cancelSecond()
+	if hub.polling("940GZZLUBST") {
+		t.Errorf("Poller still running without viewers")
+	}
+}
+
+func TestNextPollDelay(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	expiring := func(in time.Duration) *models.TflAPIPresentationEntitiesPrediction {
+		return &models.TflAPIPresentationEntitiesPrediction{TimeToLive: strfmt.DateTime(now.Add(in))}
+	}
+	tests := []struct {
+		name        string
+		predictions []*models.TflAPIPresentationEntitiesPrediction
+		want        time.Duration
+	}{
+		{"no predictions", nil, boardPollMax},
+		{"no time to live", []*models.TflAPIPresentationEntitiesPrediction{{}}, boardPollMax},
+		{"earliest expiry", []*models.TflAPIPresentationEntitiesPrediction{expiring(20 * time.Second), expiring(12 * time.Second)}, 12 * time.Second},
+		{"already expired", []*models.TflAPIPresentationEntitiesPrediction{expiring(-time.Minute)}, boardPollMin},
+		{"far future", []*models.TflAPIPresentationEntitiesPrediction{expiring(time.Hour)}, boardPollMax},
+	}
+	for _, tt := range tests {
+		if got := nextPollDelay(tt.predictions, now); got != tt.want {
+			t.Errorf("%s: nextPollDelay = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBoardStreamHandler(t *testing.T) {
+	hub := newBoardHub(func(stopID string) ([]*models.TflAPIPresentationEntitiesPrediction, error) {
+		return []*models.TflAPIPresentationEntitiesPrediction{
+			{LineID: "metropolitan", PlatformName: "Platform 1", DestinationName: "Amersham Underground Station", TimeToStation: 120},
+			{LineID: "jubilee", PlatformName: "Platform 2", DestinationName: "Stanmore Underground Station", TimeToStation: 60},
+		}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/board/stream?stop=940GZZLUBST&line=metropolitan", nil).WithContext(ctx)
+	rec := newStreamRecorder()
+	done := make(chan struct{})
+	go func() {
+		BoardStreamHandler(hub)(rec, req)
+		close(done)
+	}()
+
+	// Wait for the first event, then disconnect.
+	timeout := time.After(5 * time.Second)
+	for !strings.Contains(rec.body(), "event: arrivals") {
+		select {
+		case <-rec.written:
+		case <-timeout:
+			t.Fatalf("No arrivals event within 5s: %q", rec.body())
+		}
+	}
+	cancel()
+	<-done
+
+	if got := rec.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	body := rec.body()
+	if !strings.Contains(body, "event: arrivals\ndata: <div class='board'>") {
+		t.Errorf("Stream doesn't contain an arrivals event: %q", body)
+	}
+	if !strings.Contains(body, "Amersham") || strings.Contains(body, "Stanmore") {
+		t.Errorf("Stream isn't restricted to the requested line: %q", body)
+	}
+	if hub.polling("940GZZLUBST") {
+		t.Errorf("Poller still running after the viewer disconnected")
+	}
+}
+
+// streamRecorder is a ResponseRecorder that can be read while a streaming
+// handler is still writing to it. written receives after each write.
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+	mu      sync.Mutex
+	written chan struct{}
+}
+
+func newStreamRecorder() *streamRecorder {
+	return &streamRecorder{ResponseRecorder: httptest.NewRecorder(), written: make(chan struct{}, 1)}
+}
+
+func (r *streamRecorder) WriteHeader(code int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ResponseRecorder.WriteHeader(code)
+}
+
+func (r *streamRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	n, err := r.ResponseRecorder.Write(p)
+	r.mu.Unlock()
+	select {
+	case r.written <- struct{}{}:
+	default:
+	}
+	return n, err
+}
+
+func (r *streamRecorder) WriteString(str string) (int, error) {
+	return r.Write([]byte(str))
+}
+
+func (r *streamRecorder) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ResponseRecorder.Flush()
+}
+
+func (r *streamRecorder) body() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Body.String()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"tfltt/tfl/models"
+
+	"github.com/go-openapi/strfmt"
+)
+
+func TestGroupArrivals(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	prediction := func(platform, destination string, inSeconds int) *models.TflAPIPresentationEntitiesPrediction {
+		return &models.TflAPIPresentationEntitiesPrediction{
+			PlatformName:    platform,
+			DestinationName: destination,
+			ExpectedArrival: strfmt.DateTime(now.Add(time.Duration(inSeconds) * time.Second)),
+		}
+	}
+	predictions := []*models.TflAPIPresentationEntitiesPrediction{
+		prediction("Southbound - Platform 2", "Aldgate Underground Station", 420),
+		prediction("Northbound - Platform 1", "Amersham Underground Station", 300),
+		prediction("Southbound - Platform 2", "Baker Street Underground Station", 30),
+		prediction("Northbound - Platform 1", "Watford Underground Station", 90),
+		// Without an expected arrival, the time to station applies.
+		{PlatformName: "Northbound - Platform 1", DestinationName: "Uxbridge Underground Station", TimeToStation: 200, Timestamp: strfmt.DateTime(now)},
+	}
+
+	groups := groupArrivals(predictions, now)
+	if len(groups) != 2 {
+		t.Fatalf("Got %d platforms, want 2", len(groups))
+	}
+	if groups[0].platform != "Northbound - Platform 1" || groups[1].platform != "Southbound - Platform 2" {
+		t.Errorf("Platforms = %q, %q, want them in name order", groups[0].platform, groups[1].platform)
+	}
+	var got []string
+	for _, p := range groups[0].predictions {
+		got = append(got, p.DestinationName+" "+minutesToArrival(p, now))
+	}
+	want := []string{
+		"Watford Underground Station 1 min",
+		"Uxbridge Underground Station 3 min",
+		"Amersham Underground Station 5 min",
+	}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Northbound arrivals = %v, want %v", got, want)
+	}
+	if got := minutesToArrival(groups[1].predictions[0], now); got != "due" {
+		t.Errorf("Arrival in 30s shows %q, want due", got)
+	}
+
+	output := renderTestPartial(t, "board", boardPlatforms(groups, now))
+	for _, want := range []string{"<h2>Northbound - Platform 1</h2>", ">Watford</td><td class='due'>1 min</td>", ">Baker Street</td><td class='due'>due</td>"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Board doesn't contain %q", want)
+		}
+	}
+}
+
+func TestBoardEscapes(t *testing.T) {
+	now := time.Now()
+	groups := groupArrivals([]*models.TflAPIPresentationEntitiesPrediction{{
+		PlatformName:    "<b>1</b>",
+		DestinationName: "<script>alert(1)</script>",
+		CurrentLocation: "At <i>Harrow</i>",
+	}}, now)
+	output := renderTestPartial(t, "board", boardPlatforms(groups, now))
+	if strings.Contains(output, "<script>") || strings.Contains(output, "<b>") || strings.Contains(output, "<i>") {
+		t.Errorf("Board contains unescaped prediction text: %s", output)
+	}
+}
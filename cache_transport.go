@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// cacheRule caches responses for paths matching pattern for ttl.
+type cacheRule struct {
+	pattern *regexp.Regexp
+	ttl     time.Duration
+}
+
+// tflCacheRules are the TTLs of the TfL endpoints tfltt calls, first match
+// wins. Timetables and route lists change a few times a year; statuses and
+// disruptions within minutes; predictions within seconds. Predictions expire
+// by the board's shortest poll interval, so that each poll of a board stream
+// reaches TfL.
+var tflCacheRules = []cacheRule{
+	{regexp.MustCompile(`^/Line/[^/]+/Arrivals/`), boardPollMin},
+	{regexp.MustCompile(`^/StopPoint/[^/]+/(Arrivals|ArrivalDepartures)$`), boardPollMin},
+	{regexp.MustCompile(`^/Line/(Mode/)?[^/]+/(Status|Disruption)$`), time.Minute},
+	{regexp.MustCompile(`^/Line/[^/]+/Timetable/`), 24 * time.Hour},
+	{regexp.MustCompile(`^/Line/[^/]+/Route/Sequence/`), 24 * time.Hour},
+	{regexp.MustCompile(`^/Line/[^/]+/StopPoints$`), 24 * time.Hour},
+	{regexp.MustCompile(`^/Line/Mode/[^/]+/Route$`), 24 * time.Hour},
+	{regexp.MustCompile(`^/Line/Meta/Modes$`), 24 * time.Hour},
+}
+
+// cacheSweepSize is the number of in-memory entries above which expired
+// entries are dropped.
+const cacheSweepSize = 1000
+
+// cacheEntry is a cached response, as stored in memory and on disk.
+type cacheEntry struct {
+	Key      string    `json:"key"`
+	Expires  time.Time `json:"expires"`
+	Response []byte    `json:"response"`
+}
+
+// CachingTransport caches successful GET responses for the TTL of the first
+// rule matching the request path. Requests matching no rule pass through.
+// If Dir is set, entries are also written there, so that the cache survives
+// restarts.
+type CachingTransport struct {
+	Transport http.RoundTripper
+	Rules     []cacheRule
+	Dir       string
+
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// NewCachingTransport returns a CachingTransport with the TfL endpoint TTLs,
+// persisting to dir if it is not empty.
+func NewCachingTransport(transport http.RoundTripper, dir string) *CachingTransport {
+	return &CachingTransport{
+		Transport: transport,
+		Rules:     tflCacheRules,
+		Dir:       dir,
+		now:       time.Now,
+		entries:   make(map[string]cacheEntry),
+	}
+}
+
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ttl := t.ttl(req)
+	if ttl == 0 {
+		return t.Transport.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	if entry, ok := t.lookup(key); ok {
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(entry.Response)), req)
+		if err == nil {
+			return resp, nil
+		}
+		log.Printf("Error reading cached response for %s: %v", key, err)
+	}
+
+	resp, err := t.Transport.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	dump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return nil, err
+	}
+	t.store(cacheEntry{Key: key, Expires: t.now().Add(ttl), Response: dump})
+	return resp, nil
+}
+
+// ttl returns how long to cache the response to req, or 0 not to cache it.
+func (t *CachingTransport) ttl(req *http.Request) time.Duration {
+	if req.Method != http.MethodGet {
+		return 0
+	}
+	for _, r := range t.Rules {
+		if r.pattern.MatchString(req.URL.Path) {
+			return r.ttl
+		}
+	}
+	return 0
+}
+
+// cacheKey identifies a request by its URL without the app_key, so that the
+// key never reaches the disk.
+func cacheKey(req *http.Request) string {
+	u := *req.URL
+	q := u.Query()
+	q.Del("app_key")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// lookup returns the unexpired entry for key, from memory or else from disk.
+func (t *CachingTransport) lookup(key string) (cacheEntry, bool) {
+	now := t.now()
+	t.mu.Lock()
+	entry, ok := t.entries[key]
+	t.mu.Unlock()
+	if ok && now.Before(entry.Expires) {
+		return entry, true
+	}
+	if t.Dir == "" {
+		return cacheEntry{}, false
+	}
+
+	data, err := os.ReadFile(t.path(key))
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Key != key || !now.Before(entry.Expires) {
+		os.Remove(t.path(key))
+		return cacheEntry{}, false
+	}
+	t.mu.Lock()
+	t.entries[key] = entry
+	t.mu.Unlock()
+	return entry, true
+}
+
+// store keeps entry in memory and, if the cache is persistent, on disk.
+func (t *CachingTransport) store(entry cacheEntry) {
+	t.mu.Lock()
+	t.entries[entry.Key] = entry
+	if len(t.entries) > cacheSweepSize {
+		now := t.now()
+		for k, e := range t.entries {
+			if !now.Before(e.Expires) {
+				delete(t.entries, k)
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	if t.Dir == "" {
+		return
+	}
+	if err := t.writeFile(entry); err != nil {
+		log.Printf("Error persisting cached response for %s: %v", entry.Key, err)
+	}
+}
+
+// writeFile writes entry to the cache directory, replacing any earlier entry
+// for its key atomically.
+func (t *CachingTransport) writeFile(entry cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(t.Dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(t.Dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), t.path(entry.Key))
+}
+
+func (t *CachingTransport) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(t.Dir, hex.EncodeToString(sum[:])+".json")
+}
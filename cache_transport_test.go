@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingTransport answers every request with a body naming the request
+// and its sequence number.
+type countingTransport struct {
+	calls  int
+	status int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.calls++
+	status := c.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	body := fmt.Sprintf("%s #%d", req.URL.Path, c.calls)
+	return &http.Response{
+		StatusCode:    status,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func get(t *testing.T, rt http.RoundTripper, rawURL string) string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip(%s): %v", rawURL, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestCachingTransport(t *testing.T) {
+	upstream := &countingTransport{}
+	cache := NewCachingTransport(upstream, "")
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	const timetable = "https://api.tfl.gov.uk/Line/metropolitan/Timetable/940GZZLUAMS/to/940GZZLUALD"
+	first := get(t, cache, timetable+"?app_key=one")
+	// A different app_key is the same request.
+	if got := get(t, cache, timetable+"?app_key=two"); got != first {
+		t.Errorf("Second request got %q, want cached %q", got, first)
+	}
+	if upstream.calls != 1 {
+		t.Errorf("Upstream called %d times, want 1", upstream.calls)
+	}
+
+	// Arrivals expire within seconds, timetables within a day.
+	const arrivals = "https://api.tfl.gov.uk/StopPoint/940GZZLUBST/Arrivals"
+	get(t, cache, arrivals)
+	now = now.Add(time.Minute)
+	get(t, cache, arrivals)
+	get(t, cache, timetable)
+	if upstream.calls != 3 {
+		t.Errorf("Upstream called %d times, want 3", upstream.calls)
+	}
+
+	// Uncached endpoints and errors pass through.
+	get(t, cache, "https://api.tfl.gov.uk/Journey/JourneyResults/a/to/b")
+	get(t, cache, "https://api.tfl.gov.uk/Journey/JourneyResults/a/to/b")
+	upstream.status = http.StatusInternalServerError
+	get(t, cache, "https://api.tfl.gov.uk/Line/Meta/Modes")
+	upstream.status = http.StatusOK
+	get(t, cache, "https://api.tfl.gov.uk/Line/Meta/Modes")
+	if upstream.calls != 7 {
+		t.Errorf("Upstream called %d times, want 7", upstream.calls)
+	}
+}
+
+func TestCachingTransportBoardPoll(t *testing.T) {
+	upstream := &countingTransport{}
+	cache := NewCachingTransport(upstream, "")
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	// Board viewers share arrivals fetched within a poll interval, but the
+	// next poll of a board stream is never served from the cache.
+	const arrivals = "https://api.tfl.gov.uk/StopPoint/940GZZLUBST/Arrivals"
+	get(t, cache, arrivals)
+	now = now.Add(boardPollMin - time.Second)
+	get(t, cache, arrivals)
+	if upstream.calls != 1 {
+		t.Errorf("Upstream called %d times within a poll interval, want 1", upstream.calls)
+	}
+	now = now.Add(time.Second)
+	get(t, cache, arrivals)
+	if upstream.calls != 2 {
+		t.Errorf("Upstream called %d times after boardPollMin, want 2", upstream.calls)
+	}
+}
+
+func TestCachingTransportPersists(t *testing.T) {
+	dir := t.TempDir()
+	const routes = "https://api.tfl.gov.uk/Line/Mode/tube/Route?app_key=secret"
+
+	upstream := &countingTransport{}
+	first := get(t, NewCachingTransport(upstream, dir), routes)
+
+	// A restarted server reads the response from disk.
+	restarted := NewCachingTransport(upstream, dir)
+	if got := get(t, restarted, routes); got != first {
+		t.Errorf("After restart got %q, want %q", got, first)
+	}
+	if upstream.calls != 1 {
+		t.Errorf("Upstream called %d times, want 1", upstream.calls)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Cache directory has %v, %v; want one entry", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("Cache file contains the app key: %s", data)
+	}
+
+	// Expired entries on disk are not used.
+	expired := NewCachingTransport(upstream, dir)
+	expired.now = func() time.Time { return time.Now().Add(48 * time.Hour) }
+	get(t, expired, routes)
+	if upstream.calls != 2 {
+		t.Errorf("Upstream called %d times, want 2", upstream.calls)
+	}
+}
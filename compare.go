@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// comparePeriod is a part of the day whose frequency a comparison reports,
+// as ranges of clock hours [from, to).
+type comparePeriod struct {
+	name  string
+	hours [][2]int
+}
+
+// comparePeriods are the weekday off-peak and the morning and evening peaks.
+var comparePeriods = []comparePeriod{
+	{"Off-peak", [][2]int{{10, 16}}},
+	{"Peak", [][2]int{{7, 10}, {16, 19}}},
+}
+
+func (p comparePeriod) contains(hour int) bool {
+	for _, h := range p.hours {
+		if hour >= h[0] && hour < h[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the hours of the period, e.g. "07:00-10:00, 16:00-19:00".
+func (p comparePeriod) String() string {
+	var ranges []string
+	for _, h := range p.hours {
+		ranges = append(ranges, fmt.Sprintf("%02d:00-%02d:00", h[0], h[1]))
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// scheduleStats summarises one schedule's service at one stop.
+type scheduleStats struct {
+	firstLastTrain
+	perHour []int         // most trains calling in any one clock hour of each of comparePeriods
+	typical time.Duration // median journey time from the origin stop
+}
+
+// ScheduleComparison lines up several schedules of the same route (e.g.
+// "Monday - Friday", "Saturday" and "Sunday") stop by stop.
+type ScheduleComparison struct {
+	renderers []*TimetableRenderer
+	stops     []stopInfo
+	stats     [][]scheduleStats // [renderer][stop]
+}
+
+// NewScheduleComparison compares the schedules rendered by renderers, which
+// must all be for the same route. It has a row for every stop of any of the
+// schedules.
+func NewScheduleComparison(renderers []*TimetableRenderer) (*ScheduleComparison, error) {
+	if len(renderers) == 0 {
+		return nil, fmt.Errorf("no schedules to compare")
+	}
+	c := &ScheduleComparison{renderers: renderers, stops: comparisonStops(renderers)}
+	for _, tr := range renderers {
+		c.stats = append(c.stats, tr.stopStats(c.stops))
+	}
+	return c, nil
+}
+
+// comparisonStops merges the stops of every renderer in route order, so that
+// stops served by only some schedules, such as a weekend-only branch, still
+// get a row.
+func comparisonStops(renderers []*TimetableRenderer) []stopInfo {
+	g := newStopGraph()
+	info := make(map[string]stopInfo)
+	root := ""
+	for _, tr := range renderers {
+		var ids []string
+		for _, s := range tr.stops {
+			ids = append(ids, s.id)
+			if _, ok := info[s.id]; !ok {
+				info[s.id] = s
+			}
+		}
+		if root == "" && len(ids) > 0 {
+			root = ids[0]
+		}
+		g.addSequence(ids)
+	}
+
+	var stops []stopInfo
+	for _, id := range g.order(root) {
+		stops = append(stops, info[id])
+	}
+	return stops
+}
+
+// stopStats computes the service statistics of the schedule at each stop.
+func (tr *TimetableRenderer) stopStats(stops []stopInfo) []scheduleStats {
+	firstLast := make(map[string]firstLastTrain)
+	for _, fl := range tr.firstLastTrains() {
+		firstLast[fl.stop.id] = fl
+	}
+
+	stats := make([]scheduleStats, 0, len(stops))
+	for _, s := range stops {
+		st := scheduleStats{firstLastTrain: firstLast[s.id], perHour: make([]int, len(comparePeriods))}
+		st.stop = s
+
+		perHour := make(map[int]int)
+		var durations []time.Duration
+		for _, j := range tr.journeys {
+			t, ok := tr.arrivalAt(j, s.id)
+			if !ok {
+				continue
+			}
+			hour := int(time.Duration(t) / time.Hour)
+			perHour[hour]++
+			for p, period := range comparePeriods {
+				if period.contains(hour) {
+					st.perHour[p] = max(st.perHour[p], perHour[hour])
+				}
+			}
+			durations = append(durations, time.Duration(t-journeyDeparture(j)))
+		}
+		if len(durations) > 0 {
+			slices.Sort(durations)
+			st.typical = durations[len(durations)/2]
+		}
+		stats = append(stats, st)
+	}
+	return stats
+}
+
+// RenderAsText renders the comparison as a fixed-width text table with, for
+// each schedule, first and last train, off-peak/peak trains per hour and
+// typical journey time from the origin.
+func (c *ScheduleComparison) RenderAsText(stationColWidth int) string {
+	var sb strings.Builder
+	const colWidth = 24
+
+	fmt.Fprintf(&sb, "%-*s", stationColWidth, "Station")
+	for _, tr := range c.renderers {
+		name := tr.schedule.Name
+		if len(name) > colWidth {
+			name = name[:colWidth]
+		}
+		fmt.Fprintf(&sb, " | %-*s", colWidth, name)
+	}
+	sb.WriteString("\n")
+	sb.WriteString(strings.Repeat("-", stationColWidth+len(c.renderers)*(colWidth+3)))
+	sb.WriteString("\n")
+
+	for i, s := range c.stops {
+		name := s.name
+		if len(name) > stationColWidth {
+			name = name[:stationColWidth-3] + "..."
+		}
+		fmt.Fprintf(&sb, "%-*s", stationColWidth, name)
+		for k, tr := range c.renderers {
+			st := c.stats[k][i]
+			cell := "---"
+			if st.calls {
+				cell = fmt.Sprintf("%s-%s %stph %dm", st.first.Format(tr.timeFormat), st.last.Format(tr.timeFormat), formatPerHour(st.perHour), int(st.typical.Minutes()))
+			}
+			fmt.Fprintf(&sb, " | %-*s", colWidth, cell)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// comparisonTable is the data of the "comparison" partial: a column group
+// per schedule, each with a column per period, and a row per stop.
+type comparisonTable struct {
+	Schedules []string
+	Periods   []comparisonPeriod
+	Rows      []comparisonRow
+}
+
+// Span returns the number of columns in each schedule's column group.
+func (t comparisonTable) Span() int {
+	return 3 + len(t.Periods)
+}
+
+// comparisonPeriod heads the trains per hour column of a period.
+type comparisonPeriod struct {
+	Name  string
+	Hours string
+}
+
+// comparisonRow is a stop's statistics in each schedule.
+type comparisonRow struct {
+	Station string
+	Cells   []comparisonCell
+}
+
+// comparisonCell is a stop's statistics in one schedule. Calls is false if
+// no journey of the schedule calls at the stop.
+type comparisonCell struct {
+	Calls   bool
+	First   string
+	Last    string
+	PerHour []int
+	Minutes int
+}
+
+// htmlTable returns the comparison for the "comparison" partial.
+func (c *ScheduleComparison) htmlTable() comparisonTable {
+	var t comparisonTable
+	for _, tr := range c.renderers {
+		t.Schedules = append(t.Schedules, tr.schedule.Name)
+	}
+	for _, p := range comparePeriods {
+		t.Periods = append(t.Periods, comparisonPeriod{Name: p.name, Hours: p.String()})
+	}
+	for i, s := range c.stops {
+		row := comparisonRow{Station: s.name}
+		for k, tr := range c.renderers {
+			st := c.stats[k][i]
+			cell := comparisonCell{Calls: st.calls}
+			if st.calls {
+				cell.First, cell.Last = st.first.Format(tr.timeFormat), st.last.Format(tr.timeFormat)
+				cell.PerHour = st.perHour
+				cell.Minutes = int(st.typical.Minutes())
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t
+}
+
+// formatPerHour joins trains per hour by period, e.g. "8/12".
+func formatPerHour(perHour []int) string {
+	parts := make([]string, len(perHour))
+	for i, n := range perHour {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, "/")
+}
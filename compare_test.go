@@ -0,0 +1,95 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestScheduleComparison(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/amersham_metropolitan_timetable.json")
+	route := timetable.Timetable.Routes[0]
+
+	var renderers []*TimetableRenderer
+	for i := range route.Schedules {
+		renderers = append(renderers, newTestRenderer(t, timetable, i))
+	}
+
+	comparison, err := NewScheduleComparison(renderers)
+	if err != nil {
+		t.Fatalf("Failed to create comparison: %v", err)
+	}
+	if len(comparison.stats) != len(route.Schedules) {
+		t.Fatalf("Compared %d schedules, want %d", len(comparison.stats), len(route.Schedules))
+	}
+
+	// Sunday service starts later than Monday - Thursday.
+	weekday, sunday := comparison.stats[0][0], comparison.stats[2][0]
+	if route.Schedules[2].Name != "Sunday" {
+		t.Fatalf("Unexpected schedule order: %s", route.Schedules[2].Name)
+	}
+	if got := weekday.first.Format(TimeFormat{}); got != "05:22" {
+		t.Errorf("Weekday first train = %s, want 05:22", got)
+	}
+	if got := sunday.first.Format(TimeFormat{}); got != "06:59" {
+		t.Errorf("Sunday first train = %s, want 06:59", got)
+	}
+	if weekday.perHour[1] == 0 || weekday.typical != 0 {
+		t.Errorf("Origin stats = %+v, want trains per hour and zero journey time", weekday)
+	}
+
+	// Weekday trains from Amersham run every half hour off-peak, but more
+	// often in the peaks; on Sundays they run half-hourly all day.
+	if got := weekday.perHour; len(got) != 2 || got[0] != 2 || got[1] != 5 {
+		t.Errorf("Weekday off-peak and peak trains per hour = %v, want [2 5]", got)
+	}
+	if got := sunday.perHour; len(got) != 2 || got[0] != 2 || got[1] != 2 {
+		t.Errorf("Sunday off-peak and peak trains per hour = %v, want [2 2]", got)
+	}
+
+	aldgate := comparison.stats[0][len(comparison.stats[0])-1]
+	if aldgate.stop.id != "940GZZLUALD" || aldgate.typical.Minutes() < 60 {
+		t.Errorf("Aldgate stats = %+v, want journey time over an hour", aldgate)
+	}
+
+	output := renderTestPartial(t, "comparison", comparison.htmlTable())
+	for _, schedule := range route.Schedules {
+		if !strings.Contains(output, schedule.Name) {
+			t.Errorf("HTML output doesn't include schedule %q", schedule.Name)
+		}
+	}
+	if !strings.Contains(output, "Off-peak tph") || !strings.Contains(output, "Peak tph") {
+		t.Errorf("HTML output doesn't head off-peak and peak columns")
+	}
+	if text := comparison.RenderAsText(35); !strings.Contains(text, "05:22-00:50 2/5tph") {
+		t.Errorf("Text output doesn't include the weekday first and last trains and frequencies:\n%s", text)
+	}
+}
+
+func TestScheduleComparisonKeepsStopsOfEverySchedule(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/rickmansworth_metropolitan_timetable.json")
+	weekday, sunday := newTestRenderer(t, timetable, 0), newTestRenderer(t, timetable, 2)
+
+	// As if the Watford branch were only served on Sundays.
+	weekday.stops = slices.DeleteFunc(weekday.stops, func(s stopInfo) bool {
+		return s.id == "940GZZLUCXY" || s.id == "940GZZLUWAF"
+	})
+
+	comparison, err := NewScheduleComparison([]*TimetableRenderer{weekday, sunday})
+	if err != nil {
+		t.Fatalf("Failed to create comparison: %v", err)
+	}
+	var got, want []string
+	for _, s := range comparison.stops {
+		got = append(got, s.id)
+	}
+	for _, s := range sunday.stops {
+		want = append(want, s.id)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Comparison stops = %v, want the Sunday stops %v", got, want)
+	}
+	if output := renderTestPartial(t, "comparison", comparison.htmlTable()); !strings.Contains(output, "Watford") {
+		t.Errorf("HTML output has no Watford row")
+	}
+}
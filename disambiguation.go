@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"tfltt/tfl/models"
+)
+
+// timetableLinkFromURI rewrites the URI of a TfL timetable disambiguation
+// option, e.g. "/Line/metropolitan/Timetable/940GZZLUAMS/to/940GZZLUALD",
+// into a link to our own /timetable page, keeping the direction the option
+// picks, if any. It reports false if the URI does not name a line, origin and
+// destination.
+func timetableLinkFromURI(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 6 || !strings.EqualFold(parts[0], "Line") || !strings.EqualFold(parts[2], "Timetable") || !strings.EqualFold(parts[4], "to") {
+		return "", false
+	}
+
+	q := url.Values{}
+	q.Set("line", parts[1])
+	q.Set("from", parts[3])
+	q.Set("to", parts[5])
+	if direction := u.Query().Get("direction"); direction != "" {
+		q.Set("direction", direction)
+	}
+	return "/timetable?" + q.Encode(), true
+}
+
+// problemPage is the data of the page reporting an unresolved timetable.
+// Options without a URL are shown as plain text.
+type problemPage struct {
+	layoutData
+	Message string
+	Options []link
+}
+
+// timetableProblem is why a timetable request has nothing to show: a failed
+// fetch, or a response TfL could not resolve, perhaps with options to pick
+// from instead.
+type timetableProblem struct {
+	Status  int
+	Message string
+	Options []*models.TflAPIPresentationEntitiesTimetablesDisambiguationOption
+}
+
+// payloadProblem returns the problem reported by a timetable response, or nil
+// if it has neither disambiguation options nor a status message.
+func payloadProblem(payload *models.TflAPIPresentationEntitiesTimetableResponse) *timetableProblem {
+	p := &timetableProblem{Status: http.StatusNotFound, Message: payload.StatusErrorMessage}
+	if payload.Disambiguation != nil {
+		p.Options = payload.Disambiguation.DisambiguationOptions
+	}
+	if len(p.Options) == 0 && p.Message == "" {
+		return nil
+	}
+	if len(p.Options) > 0 {
+		p.Status = http.StatusMultipleChoices
+	}
+	return p
+}
+
+// writePage reports the problem as a page linking each option to our own
+// /timetable page.
+func (p *timetableProblem) writePage(w http.ResponseWriter) {
+	data := problemPage{
+		layoutData: layoutData{Title: "Timetable not found"},
+		Message:    p.Message,
+	}
+	for _, opt := range p.Options {
+		href, _ := timetableLinkFromURI(opt.URI)
+		data.Options = append(data.Options, link{Label: opt.Description, URL: href})
+	}
+	renderPage(w, p.Status, "problem", data)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tfltt/tfl/models"
+)
+
+func TestTimetableLinkFromURI(t *testing.T) {
+	testCases := []struct {
+		uri  string
+		want string
+		ok   bool
+	}{
+		{"/Line/metropolitan/Timetable/940GZZLUAMS/to/940GZZLUALD", "/timetable?from=940GZZLUAMS&line=metropolitan&to=940GZZLUALD", true},
+		{"/line/district/timetable/940GZZLURMD/To/940GZZLUUPM?direction=inbound", "/timetable?direction=inbound&from=940GZZLURMD&line=district&to=940GZZLUUPM", true},
+		{"/Line/metropolitan/Timetable/940GZZLUAMS", "", false},
+		{"/StopPoint/940GZZLUAMS", "", false},
+	}
+	for _, tc := range testCases {
+		got, ok := timetableLinkFromURI(tc.uri)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("timetableLinkFromURI(%q) = %q, %v; want %q, %v", tc.uri, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestTimetableProblem(t *testing.T) {
+	rec := httptest.NewRecorder()
+	payload := &models.TflAPIPresentationEntitiesTimetableResponse{
+		Disambiguation: &models.TflAPIPresentationEntitiesTimetablesDisambiguation{
+			DisambiguationOptions: []*models.TflAPIPresentationEntitiesTimetablesDisambiguationOption{
+				{Description: "Amersham <to> Aldgate", URI: "/Line/metropolitan/Timetable/940GZZLUAMS/to/940GZZLUALD"},
+			},
+		},
+	}
+	p := payloadProblem(payload)
+	if p == nil {
+		t.Fatalf("payloadProblem reported no problem for a disambiguation")
+	}
+	p.writePage(rec)
+	if rec.Code != http.StatusMultipleChoices {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusMultipleChoices)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `href="/timetable?from=940GZZLUAMS&amp;line=metropolitan&amp;to=940GZZLUALD"`) {
+		t.Errorf("Body doesn't link to our timetable page: %s", body)
+	}
+	if !strings.Contains(body, "Amersham &lt;to&gt; Aldgate") {
+		t.Errorf("Body doesn't escape the option description: %s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	payload = &models.TflAPIPresentationEntitiesTimetableResponse{StatusErrorMessage: "Stop not served by line"}
+	if p := payloadProblem(payload); p == nil {
+		t.Errorf("payloadProblem reported no problem for a status message")
+	} else if p.writePage(rec); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "Stop not served by line") {
+		t.Errorf("Status message gave status %d, want %d and the message", rec.Code, http.StatusNotFound)
+	}
+
+	if payloadProblem(&models.TflAPIPresentationEntitiesTimetableResponse{}) != nil {
+		t.Errorf("payloadProblem reported a problem for an empty response")
+	}
+}
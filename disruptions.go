@@ -0,0 +1,80 @@
+package main
+
+import (
+	"cmp"
+	"log"
+	"strings"
+
+	"tfltt/tfl/client"
+	"tfltt/tfl/client/line"
+	"tfltt/tfl/models"
+)
+
+// fetchLineDisruptions returns the current disruptions on lineID, or nil if
+// they are unavailable.
+func fetchLineDisruptions(tflClient *client.Tfl, lineID string) []*models.TflAPIPresentationEntitiesDisruption {
+	params := line.NewLineDisruptionParams()
+	params.Ids = []string{lineID}
+	resp, err := tflClient.Line.LineDisruption(params)
+	if err != nil {
+		log.Printf("Error getting disruptions for %s: %v", lineID, err)
+		return nil
+	}
+	return resp.Payload
+}
+
+// disruptionNotice describes a disruption: its title, paragraphs of
+// description and the names of the affected stops, if any.
+type disruptionNotice struct {
+	Title         string
+	Paragraphs    []string
+	AffectedStops string
+}
+
+// newDisruptionNotice returns a notice titled with d's category, or with
+// fallback if it has none, showing the non-empty texts.
+func newDisruptionNotice(d *models.TflAPIPresentationEntitiesDisruption, fallback string, texts ...string) disruptionNotice {
+	n := disruptionNotice{Title: cmp.Or(d.CategoryDescription, fallback)}
+	for _, text := range texts {
+		if text != "" {
+			n.Paragraphs = append(n.Paragraphs, text)
+		}
+	}
+	var stops []string
+	for _, stop := range d.AffectedStops {
+		stops = append(stops, shortStationName(stop.CommonName))
+	}
+	n.AffectedStops = strings.Join(stops, ", ")
+	return n
+}
+
+// disruptionBanner returns the notices for the "disruption-banner" partial
+// shown above a timetable. TfL repeats a disruption for each affected route,
+// so entries with the same description are shown once.
+func disruptionBanner(disruptions []*models.TflAPIPresentationEntitiesDisruption) []disruptionNotice {
+	var notices []disruptionNotice
+	seen := make(map[string]bool)
+	for _, d := range disruptions {
+		if seen[d.Description] {
+			continue
+		}
+		seen[d.Description] = true
+		notices = append(notices, newDisruptionNotice(d, "Disruption", d.Description, d.ClosureText))
+	}
+	return notices
+}
+
+// SetDisruptions highlights the stops affected by disruptions in the rows of
+// the HTML timetable.
+func (tr *TimetableRenderer) SetDisruptions(disruptions []*models.TflAPIPresentationEntitiesDisruption) {
+	tr.disrupted = make(map[string]bool)
+	for _, d := range disruptions {
+		for _, stop := range d.AffectedStops {
+			for _, id := range []string{stop.ID, stop.NaptanID, stop.StationNaptan} {
+				if id != "" {
+					tr.disrupted[id] = true
+				}
+			}
+		}
+	}
+}
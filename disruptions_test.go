@@ -0,0 +1,58 @@
+package main
+
+import (
+	"html"
+	"strings"
+	"testing"
+
+	"tfltt/tfl/models"
+)
+
+func TestSetDisruptions(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/amersham_metropolitan_timetable.json")
+
+	renderer := newTestRenderer(t, timetable, 0)
+	renderer.SetPage(1)
+	affected := renderer.stops[1]
+	renderer.SetDisruptions([]*models.TflAPIPresentationEntitiesDisruption{{
+		AffectedStops: []*models.TflAPIPresentationEntitiesStopPoint{{ID: affected.id, CommonName: affected.name}},
+	}})
+
+	output := renderTestPartial(t, "timetable", renderer.timetableView(journeysPerPage))
+	if got := strings.Count(output, "<tr class=\"disrupted\">"); got != 1 {
+		t.Errorf("Got %d disrupted rows, want 1", got)
+	}
+	if want := "<tr class=\"disrupted\"><th class=\"station\" scope=\"row\" title=\"Affected by disruption\">" + html.EscapeString(affected.name) + "</th>"; !strings.Contains(output, want) {
+		t.Errorf("HTML doesn't highlight %s", affected.name)
+	}
+}
+
+func TestDisruptionBanner(t *testing.T) {
+	if got := renderTestPartial(t, "disruption-banner", disruptionBanner(nil)); got != "" {
+		t.Errorf("Banner without disruptions = %q, want none", got)
+	}
+
+	closure := &models.TflAPIPresentationEntitiesDisruption{
+		CategoryDescription: "PlannedWork",
+		Description:         "No service between Harrow-on-the-Hill & Amersham.",
+		ClosureText:         "partClosure",
+		AffectedStops: []*models.TflAPIPresentationEntitiesStopPoint{
+			{CommonName: "Harrow-on-the-Hill Underground Station"},
+			{CommonName: "Amersham Underground Station"},
+		},
+	}
+	output := renderTestPartial(t, "disruption-banner", disruptionBanner([]*models.TflAPIPresentationEntitiesDisruption{closure, closure}))
+	if got := strings.Count(output, "<article>"); got != 1 {
+		t.Errorf("Banner shows %d disruptions, want repeats shown once", got)
+	}
+	for _, want := range []string{
+		"<h2>PlannedWork</h2>",
+		"<p>No service between Harrow-on-the-Hill &amp; Amersham.</p>",
+		"<p>partClosure</p>",
+		"Affected stops: Harrow-on-the-Hill, Amersham",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Banner doesn't contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// WriteCSV writes the schedule as a stop × journey grid: a row naming the
+// schedule, a header row of journey departure times and destinations, then
+// one row per stop with its short name and ID. Stops a journey does not call
+// at are left empty. Every journey selected by the filter is written.
+func (tr *TimetableRenderer) WriteCSV(w *csv.Writer) error {
+	journeys := tr.selectedJourneys()
+
+	if err := w.Write([]string{"Schedule", tr.schedule.Name}); err != nil {
+		return err
+	}
+
+	header := []string{"Station", "Stop ID"}
+	for _, j := range journeys {
+		dest := shortStationName(tr.stationNames[tr.journeyDestination(j)])
+		header = append(header, fmt.Sprintf("%s to %s", journeyDeparture(j).Format(tr.timeFormat), dest))
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, s := range tr.stops {
+		row := []string{shortStationName(s.name), s.id}
+		for _, j := range journeys {
+			cell := ""
+			if t, ok := tr.arrivalAt(j, s.id); ok {
+				cell = t.Format(tr.timeFormat)
+			}
+			row = append(row, cell)
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// exportFilename builds a download filename such as
+// "metropolitan_940GZZLUAMS_940GZZLUALD.csv".
+func exportFilename(ext string, parts ...string) string {
+	var safe []string
+	for _, p := range parts {
+		if p != "" {
+			safe = append(safe, unsafeFilenameChars.ReplaceAllString(p, "-"))
+		}
+	}
+	return strings.Join(safe, "_") + "." + ext
+}
+
+// writeCSVExport writes every schedule in renderers as one delimited file,
+// separating schedules with a blank row. format is "csv" or "tsv".
+func writeCSVExport(w http.ResponseWriter, renderers []*TimetableRenderer, format, filename string) {
+	cw := csv.NewWriter(w)
+	contentType := "text/csv; charset=utf-8"
+	if format == "tsv" {
+		cw.Comma = '\t'
+		contentType = "text/tab-separated-values; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	for i, tr := range renderers {
+		if i > 0 {
+			cw.Write(nil)
+		}
+		if err := tr.WriteCSV(cw); err != nil {
+			// Headers are already sent, so the error can only be logged.
+			log.Printf("Error writing %s export: %v", format, err)
+			return
+		}
+	}
+}
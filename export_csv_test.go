@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteCSVExport(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/amersham_metropolitan_timetable.json")
+	route := timetable.Timetable.Routes[0]
+	schedule := route.Schedules[0]
+
+	renderer := newTestRenderer(t, timetable, 0)
+
+	rec := httptest.NewRecorder()
+	writeCSVExport(rec, []*TimetableRenderer{renderer}, "tsv", exportFilename("tsv", "metropolitan", "940GZZLUAMS", "940GZZLUALD"))
+
+	if got, want := rec.Header().Get("Content-Disposition"), `attachment; filename="metropolitan_940GZZLUAMS_940GZZLUALD.tsv"`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+
+	r := csv.NewReader(strings.NewReader(rec.Body.String()))
+	r.Comma = '\t'
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse TSV: %v", err)
+	}
+	if len(rows) != 2+len(renderer.stops) {
+		t.Fatalf("Got %d rows, want %d", len(rows), 2+len(renderer.stops))
+	}
+	if rows[0][1] != schedule.Name {
+		t.Errorf("Schedule row = %v", rows[0])
+	}
+	if got, want := len(rows[1]), 2+len(schedule.KnownJourneys); got != want {
+		t.Errorf("Header has %d columns, want %d", got, want)
+	}
+	if rows[1][2] != "05:22 to Aldgate" {
+		t.Errorf("First journey header = %q, want %q", rows[1][2], "05:22 to Aldgate")
+	}
+	if rows[2][0] != "Amersham" || rows[2][1] != "940GZZLUAMS" || rows[2][2] != "05:22" {
+		t.Errorf("First stop row starts %v", rows[2][:3])
+	}
+}
+
+func TestExportFilenameSanitises(t *testing.T) {
+	if got, want := exportFilename("csv", "a/b", "c d", `e"f`), "a-b_c-d_e-f.csv"; got != want {
+		t.Errorf("exportFilename = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"tfltt/tfl/models"
+)
+
+// firstLastTrain is the first and last train calling at a stop.
+type firstLastTrain struct {
+	stop  stopInfo
+	first ServiceTime
+	last  ServiceTime
+	calls bool // false if no journey in the schedule calls at the stop
+}
+
+// arrivalAt returns the time journey j calls at stopID, computed through the
+// journey's station interval.
+func (tr *TimetableRenderer) arrivalAt(j *models.TflAPIPresentationEntitiesKnownJourney, stopID string) (ServiceTime, bool) {
+	offsets, ok := tr.journeyOffsets(j)
+	if !ok {
+		return 0, false
+	}
+	off, found := offsets[stopID]
+	if !found {
+		return 0, false
+	}
+	return calculateArrivalTime(j.Hour, j.Minute, off), true
+}
+
+// firstLastTrains returns the first and last train at every stop. The
+// schedule's FirstJourney and LastJourney are considered alongside its known
+// journeys, so the result is unaffected by any truncation of the table.
+func (tr *TimetableRenderer) firstLastTrains() []firstLastTrain {
+	candidates := append([]*models.TflAPIPresentationEntitiesKnownJourney(nil), tr.journeys...)
+	for _, j := range []*models.TflAPIPresentationEntitiesKnownJourney{tr.schedule.FirstJourney, tr.schedule.LastJourney} {
+		if j != nil {
+			candidates = append(candidates, j)
+		}
+	}
+
+	result := make([]firstLastTrain, 0, len(tr.stops))
+	for _, s := range tr.stops {
+		fl := firstLastTrain{stop: s}
+		for _, j := range candidates {
+			t, ok := tr.arrivalAt(j, s.id)
+			if !ok {
+				continue
+			}
+			if !fl.calls || t < fl.first {
+				fl.first = t
+			}
+			if !fl.calls || t > fl.last {
+				fl.last = t
+			}
+			fl.calls = true
+		}
+		result = append(result, fl)
+	}
+	return result
+}
+
+// RenderFirstLastText renders the first and last train at every stop as a
+// fixed-width text table.
+func (tr *TimetableRenderer) RenderFirstLastText(stationColWidth int) string {
+	var sb strings.Builder
+	const colWidth = 10
+	fmt.Fprintf(&sb, "%-*s | %-*s | %-*s\n", stationColWidth, "Station", colWidth, "First", colWidth, "Last")
+	sb.WriteString(strings.Repeat("-", stationColWidth+2*(colWidth+3)))
+	sb.WriteString("\n")
+	for _, fl := range tr.firstLastTrains() {
+		name := fl.stop.name
+		if len(name) > stationColWidth {
+			name = name[:stationColWidth-3] + "..."
+		}
+		first, last := "---", "---"
+		if fl.calls {
+			first, last = fl.first.Format(tr.timeFormat), fl.last.Format(tr.timeFormat)
+		}
+		fmt.Fprintf(&sb, "%-*s | %-*s | %-*s\n", stationColWidth, name, colWidth, first, colWidth, last)
+	}
+	return sb.String()
+}
+
+// firstLastRow is a stop's first and last train, formatted for the
+// "first-last" partial. Calls is false if no journey calls at the stop.
+type firstLastRow struct {
+	Station string
+	First   string
+	Last    string
+	Calls   bool
+}
+
+// firstLastRows returns the first and last train at every stop for the
+// "first-last" partial.
+func (tr *TimetableRenderer) firstLastRows() []firstLastRow {
+	var rows []firstLastRow
+	for _, fl := range tr.firstLastTrains() {
+		row := firstLastRow{Station: fl.stop.name, Calls: fl.calls}
+		if fl.calls {
+			row.First, row.Last = fl.first.Format(tr.timeFormat), fl.last.Format(tr.timeFormat)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
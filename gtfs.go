@@ -0,0 +1,336 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"tfltt/tfl/client"
+	"tfltt/tfl/models"
+)
+
+// gtfsRouteTypes maps TfL modes to GTFS route_type values.
+var gtfsRouteTypes = map[string]int{
+	"tram":               0,
+	"dlr":                0,
+	"tube":               1,
+	"overground":         2,
+	"elizabeth-line":     2,
+	"national-rail":      2,
+	"bus":                3,
+	"river-bus":          4,
+	"cable-car":          6,
+	"river-tour":         4,
+	"international-rail": 2,
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// gtfsValidity is how long the calendar of an exported feed runs for. TfL
+// timetables carry no validity dates of their own.
+const gtfsValidity = 365 * 24 * time.Hour
+
+type gtfsRoute struct {
+	id, name  string
+	routeType int
+}
+
+type gtfsTrip struct {
+	id, routeID, serviceID, headsign string
+	directionID                      int
+}
+
+type gtfsStopTime struct {
+	tripID, stopID, time string
+	sequence             int
+}
+
+// gtfsFeed accumulates TfL timetables into a GTFS static feed.
+type gtfsFeed struct {
+	start     time.Time
+	routes    []gtfsRoute
+	stops     []*models.TflAPIPresentationEntitiesMatchedStop
+	services  map[string][7]bool
+	trips     []gtfsTrip
+	stopTimes []gtfsStopTime
+
+	seenRoutes map[string]bool
+	seenStops  map[string]bool
+	seenTrips  map[string]bool
+	serviceIDs []string
+}
+
+// newGTFSFeed returns an empty feed whose calendar starts on start.
+func newGTFSFeed(start time.Time) *gtfsFeed {
+	return &gtfsFeed{
+		start:      start,
+		services:   make(map[string][7]bool),
+		seenRoutes: make(map[string]bool),
+		seenStops:  make(map[string]bool),
+		seenTrips:  make(map[string]bool),
+	}
+}
+
+// AddTimetable adds every journey of a timetable response to the feed. toID is
+// the stop the timetable was requested towards, and with the line and
+// departure stop makes the trip_ids unique across timetables. Stop times are
+// computed by TimetableRenderer, so they match the timetable pages. Stops TfL
+// gives no location for are left out of the feed.
+func (f *gtfsFeed) AddTimetable(payload *models.TflAPIPresentationEntitiesTimetableResponse, toID string, routeSequence *models.TflAPIPresentationEntitiesRouteSequence, mode string) error {
+	if payload.Timetable == nil {
+		return fmt.Errorf("no timetable data available")
+	}
+
+	routeType, ok := gtfsRouteTypes[mode]
+	if !ok {
+		routeType = gtfsRouteTypes["tube"]
+	}
+	if !f.seenRoutes[payload.LineID] {
+		f.seenRoutes[payload.LineID] = true
+		f.routes = append(f.routes, gtfsRoute{id: payload.LineID, name: payload.LineName, routeType: routeType})
+	}
+
+	matched := make(map[string]*models.TflAPIPresentationEntitiesMatchedStop)
+	for _, s := range payload.Stations {
+		matched[s.ID] = s
+	}
+	for _, s := range payload.Stops {
+		matched[s.ID] = s
+	}
+	for id, s := range matched {
+		if s.Lat == 0 && s.Lon == 0 {
+			delete(matched, id)
+		}
+	}
+
+	tripPrefix := payload.LineID + "-" + payload.Timetable.DepartureStopID
+	if toID != "" {
+		tripPrefix += "-" + toID
+	}
+
+	directionID := 0
+	if strings.EqualFold(payload.Direction, "inbound") {
+		directionID = 1
+	}
+
+	for r, route := range payload.Timetable.Routes {
+		for _, schedule := range route.Schedules {
+			tr, err := NewTimetableRenderer(payload, route, schedule)
+			if err != nil {
+				return err
+			}
+			tr.UseRouteSequence(routeSequence)
+			tr.SetTimeFormat(TimeFormat{ExtendedHours: true, Seconds: true})
+
+			serviceID := f.addService(schedule.Name)
+			for i, j := range tr.journeys {
+				trip := gtfsTrip{
+					id:          fmt.Sprintf("%s-%d-%s-%d", tripPrefix, r, serviceID, i+1),
+					routeID:     payload.LineID,
+					serviceID:   serviceID,
+					headsign:    shortStationName(tr.stationNames[tr.journeyDestination(j)]),
+					directionID: directionID,
+				}
+				if f.seenTrips[trip.id] {
+					return fmt.Errorf("duplicate trip_id %s", trip.id)
+				}
+				f.seenTrips[trip.id] = true
+				f.trips = append(f.trips, trip)
+
+				seq := 0
+				for _, s := range tr.stops {
+					stop := matched[s.id]
+					if stop == nil {
+						continue
+					}
+					t, ok := tr.arrivalAt(j, s.id)
+					if !ok {
+						continue
+					}
+					seq++
+					f.stopTimes = append(f.stopTimes, gtfsStopTime{tripID: trip.id, stopID: s.id, time: t.Format(tr.timeFormat), sequence: seq})
+					if !f.seenStops[s.id] {
+						f.seenStops[s.id] = true
+						f.stops = append(f.stops, stop)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// addService registers the calendar of a schedule and returns its service_id.
+// Schedules whose names name no days are assumed to run daily.
+func (f *gtfsFeed) addService(scheduleName string) string {
+	id := strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(scheduleName), "-"), "-")
+	if _, ok := f.services[id]; !ok {
+		days, ok := scheduleDays(scheduleName)
+		if !ok {
+			days = [7]bool{true, true, true, true, true, true, true}
+		}
+		f.services[id] = days
+		f.serviceIDs = append(f.serviceIDs, id)
+	}
+	return id
+}
+
+// WriteZip writes the feed as a GTFS zip archive.
+func (f *gtfsFeed) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		rows [][]string
+	}{
+		{"agency.txt", f.agencyRows()},
+		{"routes.txt", f.routeRows()},
+		{"stops.txt", f.stopRows()},
+		{"calendar.txt", f.calendarRows()},
+		{"trips.txt", f.tripRows()},
+		{"stop_times.txt", f.stopTimeRows()},
+	}
+	for _, file := range files {
+		fw, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(fw)
+		if err := cw.WriteAll(file.rows); err != nil {
+			return fmt.Errorf("writing %s: %w", file.name, err)
+		}
+	}
+	return zw.Close()
+}
+
+func (f *gtfsFeed) agencyRows() [][]string {
+	return [][]string{
+		{"agency_id", "agency_name", "agency_url", "agency_timezone", "agency_lang"},
+		{"TfL", "Transport for London", "https://tfl.gov.uk", "Europe/London", "en"},
+	}
+}
+
+func (f *gtfsFeed) routeRows() [][]string {
+	rows := [][]string{{"route_id", "agency_id", "route_short_name", "route_long_name", "route_type"}}
+	for _, r := range f.routes {
+		rows = append(rows, []string{r.id, "TfL", r.name, r.name + " line", strconv.Itoa(r.routeType)})
+	}
+	return rows
+}
+
+func (f *gtfsFeed) stopRows() [][]string {
+	rows := [][]string{{"stop_id", "stop_name", "stop_lat", "stop_lon", "zone_id"}}
+	for _, s := range f.stops {
+		rows = append(rows, []string{
+			s.ID,
+			shortStationName(s.Name),
+			strconv.FormatFloat(s.Lat, 'f', 6, 64),
+			strconv.FormatFloat(s.Lon, 'f', 6, 64),
+			s.Zone,
+		})
+	}
+	return rows
+}
+
+func (f *gtfsFeed) calendarRows() [][]string {
+	rows := [][]string{{"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday", "start_date", "end_date"}}
+	start := f.start.Format("20060102")
+	end := f.start.Add(gtfsValidity).Format("20060102")
+	for _, id := range f.serviceIDs {
+		days := f.services[id]
+		row := []string{id}
+		for _, d := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+			if days[d] {
+				row = append(row, "1")
+			} else {
+				row = append(row, "0")
+			}
+		}
+		rows = append(rows, append(row, start, end))
+	}
+	return rows
+}
+
+func (f *gtfsFeed) tripRows() [][]string {
+	rows := [][]string{{"route_id", "service_id", "trip_id", "trip_headsign", "direction_id"}}
+	for _, t := range f.trips {
+		rows = append(rows, []string{t.routeID, t.serviceID, t.id, t.headsign, strconv.Itoa(t.directionID)})
+	}
+	return rows
+}
+
+func (f *gtfsFeed) stopTimeRows() [][]string {
+	rows := [][]string{{"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence"}}
+	for _, st := range f.stopTimes {
+		rows = append(rows, []string{st.tripID, st.time, st.time, st.stopID, strconv.Itoa(st.sequence)})
+	}
+	return rows
+}
+
+// GTFSHandler serves a GTFS zip built from one or more timetables. Routes are
+// given as repeated route=line:from:to parameters, or as a single line, from
+// and to; to is optional either way. mode sets the GTFS route type and defaults to tube.
+func GTFSHandler(tflClient *client.Tfl) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		routes := q["route"]
+		if len(routes) == 0 && q.Get("line") != "" && q.Get("from") != "" {
+			routes = []string{q.Get("line") + ":" + q.Get("from")}
+			if to := q.Get("to"); to != "" {
+				routes[0] += ":" + to
+			}
+		}
+		if len(routes) == 0 {
+			http.Error(w, "Missing required parameters: route=line:from[:to], or line, from and optionally to", http.StatusBadRequest)
+			return
+		}
+		mode := q.Get("mode")
+		if mode == "" {
+			mode = "tube"
+		}
+
+		feed := newGTFSFeed(time.Now())
+		seen := make(map[string]bool)
+		for _, route := range routes {
+			if seen[route] {
+				continue
+			}
+			seen[route] = true
+			parts := strings.Split(route, ":")
+			if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+				http.Error(w, fmt.Sprintf("Invalid route %q: want line:from or line:from:to", route), http.StatusBadRequest)
+				return
+			}
+			toID := ""
+			if len(parts) == 3 {
+				toID = parts[2]
+			}
+
+			// The feed is a zip, so problems are reported as plain text
+			// rather than as the problem page.
+			payload, problem := loadTimetable(tflClient, parts[0], parts[1], toID)
+			if problem != nil {
+				http.Error(w, fmt.Sprintf("Error getting timetable for %s: %s", route, problem.Message), http.StatusBadGateway)
+				return
+			}
+
+			routeSequence := fetchRouteSequence(tflClient, parts[0], payload.Direction)
+			if err := feed.AddTimetable(payload, toID, routeSequence, mode); err != nil {
+				http.Error(w, fmt.Sprintf("Error converting timetable for %s: %v", route, err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "tfl-gtfs.zip"))
+		if err := feed.WriteZip(w); err != nil {
+			log.Printf("Error writing GTFS feed: %v", err)
+		}
+	}
+}
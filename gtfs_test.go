@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+)
+
+func TestGTFSFeed(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/amersham_metropolitan_timetable.json")
+
+	feed := newGTFSFeed(time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC))
+	if err := feed.AddTimetable(timetable, "940GZZLUALD", nil, "tube"); err != nil {
+		t.Fatalf("AddTimetable failed: %v", err)
+	}
+	files := readGTFSZip(t, feed)
+
+	for _, name := range []string{"agency.txt", "routes.txt", "stops.txt", "calendar.txt", "trips.txt", "stop_times.txt"} {
+		if len(files[name]) < 2 {
+			t.Errorf("%s has no records", name)
+		}
+	}
+
+	journeys := 0
+	for _, schedule := range timetable.Timetable.Routes[0].Schedules {
+		journeys += len(schedule.KnownJourneys)
+	}
+	if got := len(files["trips.txt"]) - 1; got != journeys {
+		t.Errorf("trips.txt has %d trips, want %d", got, journeys)
+	}
+
+	calendar := make(map[string][]string)
+	for _, row := range files["calendar.txt"][1:] {
+		calendar[row[0]] = row
+	}
+	if got := calendar["monday-thursday"]; len(got) != 10 || got[1] != "1" || got[4] != "1" || got[5] != "0" || got[8] != "20260105" {
+		t.Errorf("monday-thursday calendar = %v", got)
+	}
+	if got := calendar["sunday"]; len(got) != 10 || got[7] != "1" || got[1] != "0" {
+		t.Errorf("sunday calendar = %v", got)
+	}
+
+	// The last weekday train runs past midnight.
+	var lastTime string
+	for _, row := range files["stop_times.txt"][1:] {
+		if row[0] == "metropolitan-940GZZLUAMS-940GZZLUALD-0-monday-thursday-51" && row[3] == "940GZZLUAMS" {
+			lastTime = row[1]
+		}
+	}
+	if lastTime != "24:50:00" {
+		t.Errorf("Last Monday - Thursday departure = %q, want 24:50:00", lastTime)
+	}
+}
+
+func TestGTFSFeedTripIDs(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/amersham_metropolitan_timetable.json")
+
+	feed := newGTFSFeed(time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC))
+	if err := feed.AddTimetable(timetable, "940GZZLUALD", nil, "tube"); err != nil {
+		t.Fatalf("AddTimetable failed: %v", err)
+	}
+	if err := feed.AddTimetable(timetable, "940GZZLUBST", nil, "tube"); err != nil {
+		t.Fatalf("AddTimetable towards another stop failed: %v", err)
+	}
+	if err := feed.AddTimetable(timetable, "940GZZLUALD", nil, "tube"); err == nil {
+		t.Error("Adding the same timetable twice gave no duplicate trip_id error")
+	}
+}
+
+func TestGTFSFeedSkipsUnlocatedStops(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/amersham_metropolitan_timetable.json")
+	for _, s := range timetable.Stops {
+		if s.ID == "940GZZLUCYD" {
+			s.Lat, s.Lon = 0, 0
+		}
+	}
+	for _, s := range timetable.Stations {
+		if s.ID == "940GZZLUCYD" {
+			s.Lat, s.Lon = 0, 0
+		}
+	}
+
+	feed := newGTFSFeed(time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC))
+	if err := feed.AddTimetable(timetable, "940GZZLUALD", nil, "tube"); err != nil {
+		t.Fatalf("AddTimetable failed: %v", err)
+	}
+	files := readGTFSZip(t, feed)
+
+	for _, row := range files["stops.txt"][1:] {
+		if row[0] == "940GZZLUCYD" {
+			t.Errorf("stops.txt lists unlocated stop: %v", row)
+		}
+		if row[2] == "0.000000" && row[3] == "0.000000" {
+			t.Errorf("stops.txt has a stop at 0,0: %v", row)
+		}
+	}
+	for _, row := range files["stop_times.txt"][1:] {
+		if row[3] == "940GZZLUCYD" {
+			t.Fatalf("stop_times.txt calls at unlocated stop: %v", row)
+		}
+	}
+	for _, row := range files["stop_times.txt"][1:] {
+		if row[0] == "metropolitan-940GZZLUAMS-940GZZLUALD-0-monday-thursday-1" && row[3] == "940GZZLURKW" && row[4] != "3" {
+			t.Errorf("Rickmansworth stop_sequence = %s, want 3", row[4])
+		}
+	}
+}
+
+// readGTFSZip writes feed as a zip and returns the records of each file in
+// it.
+func readGTFSZip(t *testing.T, feed *gtfsFeed) map[string][][]string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := feed.WriteZip(&buf); err != nil {
+		t.Fatalf("WriteZip failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open zip: %v", err)
+	}
+
+	files := make(map[string][][]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		rows, err := csv.NewReader(rc).ReadAll()
+		rc.Close()
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", f.Name, err)
+		}
+		files[f.Name] = rows
+	}
+	return files
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	_ "time/tzdata" // Europe/London must resolve in minimal containers
+
+	"tfltt/tfl/client"
+)
+
+// icsTimezone is the VTIMEZONE definition of Europe/London, so that calendar
+// clients apply the GMT/BST changeover to recurring events.
+const icsTimezone = `BEGIN:VTIMEZONE
+TZID:Europe/London
+BEGIN:DAYLIGHT
+TZOFFSETFROM:+0000
+TZOFFSETTO:+0100
+TZNAME:BST
+DTSTART:19700329T010000
+RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU
+END:DAYLIGHT
+BEGIN:STANDARD
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0000
+TZNAME:GMT
+DTSTART:19701025T020000
+RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU
+END:STANDARD
+END:VTIMEZONE`
+
+var icsWeekdays = [7]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// icsWriter writes iCalendar content lines, folding them at 75 octets and
+// terminating them with CRLF as RFC 5545 requires.
+type icsWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (iw *icsWriter) line(s string) {
+	if iw.err != nil {
+		return
+	}
+	for len(s) > 75 {
+		cut := 75
+		// Don't split a UTF-8 sequence.
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		_, iw.err = io.WriteString(iw.w, s[:cut]+"\r\n")
+		s = " " + s[cut:]
+	}
+	_, iw.err = io.WriteString(iw.w, s+"\r\n")
+}
+
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+// icsText escapes s for use as an iCalendar TEXT value.
+func icsText(s string) string {
+	return icsTextEscaper.Replace(s)
+}
+
+// icsEventStart returns the first date on or after from (in loc) when a
+// journey at service time t runs, given the days its schedule runs on. Times
+// past midnight fall on the following calendar day. It also returns the
+// calendar days the journey runs on, for the recurrence rule.
+func icsEventStart(t ServiceTime, days [7]bool, from time.Time, loc *time.Location) (time.Time, [7]bool) {
+	dayOffset := int(time.Duration(t) / (24 * time.Hour))
+	clock := time.Duration(t) % (24 * time.Hour)
+
+	var calendarDays [7]bool
+	for d, on := range days {
+		calendarDays[(d+dayOffset)%7] = on
+	}
+
+	from = from.In(loc)
+	date := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i < 7 && !calendarDays[date.Weekday()]; i++ {
+		date = date.AddDate(0, 0, 1)
+	}
+	start := time.Date(date.Year(), date.Month(), date.Day(), int(clock/time.Hour), int(clock%time.Hour/time.Minute), int(clock%time.Minute/time.Second), 0, loc)
+	return start, calendarDays
+}
+
+// writeICS writes a VCALENDAR with a weekly recurring VEVENT for every
+// journey selected by each renderer's filter, starting when the journey calls
+// at stopID (the origin if empty) and ending at its destination.
+func writeICS(w io.Writer, renderers []*TimetableRenderer, stopID string, now time.Time) error {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		return err
+	}
+
+	iw := &icsWriter{w: w}
+	iw.line("BEGIN:VCALENDAR")
+	iw.line("VERSION:2.0")
+	iw.line("PRODID:-//tfltt//Timetable//EN")
+	iw.line("CALSCALE:GREGORIAN")
+	for _, l := range strings.Split(icsTimezone, "\n") {
+		iw.line(l)
+	}
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, tr := range renderers {
+		days, known := scheduleDays(tr.schedule.Name)
+		if !known {
+			days = [7]bool{true, true, true, true, true, true, true}
+		}
+		board := stopID
+		if board == "" {
+			board = tr.timetable.Timetable.DepartureStopID
+		}
+
+		for _, j := range tr.selectedJourneys() {
+			departs, ok := tr.arrivalAt(j, board)
+			if !ok {
+				continue
+			}
+			dest := tr.journeyDestination(j)
+			arrives, _ := tr.arrivalAt(j, dest)
+
+			start, calendarDays := icsEventStart(departs, days, now, loc)
+			end := start.Add(time.Duration(arrives - departs))
+
+			var byDay []string
+			for d, on := range calendarDays {
+				if on {
+					byDay = append(byDay, icsWeekdays[d])
+				}
+			}
+
+			fromName := shortStationName(tr.stationNames[board])
+			toName := shortStationName(tr.stationNames[dest])
+			iw.line("BEGIN:VEVENT")
+			// Routes and directions of a line can share a boarding stop and
+			// departure time, so the UID also names the direction and
+			// destination.
+			iw.line(fmt.Sprintf("UID:%s-%s-%s-%s-%s-%s@tfltt", tr.timetable.LineID, strings.ToLower(tr.timetable.Direction),
+				nonAlphanumeric.ReplaceAllString(strings.ToLower(tr.schedule.Name), "-"), board, departs.Format(TimeFormat{ExtendedHours: true}), dest))
+			iw.line("DTSTAMP:" + stamp)
+			iw.line("DTSTART;TZID=Europe/London:" + start.Format("20060102T150405"))
+			iw.line("DTEND;TZID=Europe/London:" + end.Format("20060102T150405"))
+			if known {
+				iw.line("RRULE:FREQ=WEEKLY;BYDAY=" + strings.Join(byDay, ","))
+			}
+			iw.line("SUMMARY:" + icsText(fmt.Sprintf("%s %s to %s", tr.timetable.LineName, departs.Format(TimeFormat{}), toName)))
+			iw.line("LOCATION:" + icsText(fromName))
+			iw.line("DESCRIPTION:" + icsText(fmt.Sprintf("%s line (%s): departs %s at %s, arrives %s at %s.",
+				tr.timetable.LineName, tr.schedule.Name, fromName, departs.Format(TimeFormat{}), toName, arrives.Format(TimeFormat{}))))
+			iw.line("END:VEVENT")
+		}
+	}
+	iw.line("END:VCALENDAR")
+	return iw.err
+}
+
+// TimetableICSHandler serves the journeys of a timetable as an iCalendar
+// file. It accepts the same line, from, to, stop, after, before and count
+// parameters as /timetable.
+func TimetableICSHandler(tflClient *client.Tfl) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lineID := r.URL.Query().Get("line")
+		fromID := r.URL.Query().Get("from")
+		toID := r.URL.Query().Get("to")
+
+		if lineID == "" || fromID == "" {
+			http.Error(w, "Missing required parameters: line, from", http.StatusBadRequest)
+			return
+		}
+
+		filter, err := journeyFilterFromQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		payload, problem := loadTimetable(tflClient, lineID, fromID, toID)
+		if problem != nil {
+			problem.writePage(w)
+			return
+		}
+
+		routeSequence := fetchRouteSequence(tflClient, lineID, payload.Direction)
+		var renderers []*TimetableRenderer
+		for _, route := range payload.Timetable.Routes {
+			for _, schedule := range route.Schedules {
+				renderer, err := NewTimetableRenderer(payload, route, schedule)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Error rendering schedule %s: %v", schedule.Name, err), http.StatusInternalServerError)
+					return
+				}
+				renderer.UseRouteSequence(routeSequence)
+				renderer.SetFilter(filter)
+				renderers = append(renderers, renderer)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportFilename("ics", lineID, fromID, toID)))
+		if err := writeICS(w, renderers, filter.StopID, time.Now()); err != nil {
+			log.Printf("Error writing calendar: %v", err)
+		}
+	}
+}
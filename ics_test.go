@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestICSEventStart(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("Failed to load Europe/London: %v", err)
+	}
+	weekdays, _ := scheduleDays("Monday - Friday")
+	// Saturday 24 October 2026, the day before the clocks go back.
+	now := time.Date(2026, 10, 24, 12, 0, 0, 0, loc)
+
+	start, days := icsEventStart(parseServiceTime("7", "41"), weekdays, now, loc)
+	if got, want := start.Format(time.RFC3339), "2026-10-26T07:41:00Z"; got != want {
+		t.Errorf("start = %s, want %s (GMT after the clocks change)", got, want)
+	}
+	if days != weekdays {
+		t.Errorf("days = %v, want %v", days, weekdays)
+	}
+
+	// A 00:19 train of the Friday service runs on Saturday morning.
+	start, days = icsEventStart(parseServiceTime("24", "19"), weekdays, now, loc)
+	if got, want := start.Format(time.RFC3339), "2026-10-24T00:19:00+01:00"; got != want {
+		t.Errorf("start = %s, want %s", got, want)
+	}
+	if days[time.Monday] || !days[time.Saturday] {
+		t.Errorf("days = %v, want Tuesday to Saturday", days)
+	}
+}
+
+func TestWriteICS(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/amersham_metropolitan_timetable.json")
+
+	renderer := newTestRenderer(t, timetable, 0)
+	after, _ := parseClockTime("07:30")
+	renderer.SetFilter(JourneyFilter{After: after, StopID: "940GZZLURKW", Count: 2})
+
+	var sb strings.Builder
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	if err := writeICS(&sb, []*TimetableRenderer{renderer}, "940GZZLURKW", now); err != nil {
+		t.Fatalf("writeICS failed: %v", err)
+	}
+	output := sb.String()
+
+	if got := strings.Count(output, "BEGIN:VEVENT"); got != 2 {
+		t.Errorf("Got %d events, want 2", got)
+	}
+	for _, want := range []string{
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/London",
+		"DTSTART;TZID=Europe/London:20261019T073500\r\n",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,TU,WE,TH\r\n",
+		"LOCATION:Rickmansworth\r\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Output doesn't contain %q:\n%s", want, output)
+		}
+	}
+	for _, l := range strings.Split(output, "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("Line longer than 75 octets: %q", l)
+		}
+	}
+}
+
+func TestWriteICSUIDsDifferByDirection(t *testing.T) {
+	outbound := newTestRenderer(t, loadTestTimetable(t, "testdata/amersham_metropolitan_timetable.json"), 0)
+	inbound := newTestRenderer(t, loadTestTimetable(t, "testdata/amersham_metropolitan_timetable.json"), 0)
+	inbound.timetable.Direction = "inbound"
+	for _, tr := range []*TimetableRenderer{outbound, inbound} {
+		tr.SetFilter(JourneyFilter{Count: 1})
+	}
+
+	var sb strings.Builder
+	if err := writeICS(&sb, []*TimetableRenderer{outbound, inbound}, "", time.Now()); err != nil {
+		t.Fatalf("writeICS failed: %v", err)
+	}
+	var uids []string
+	for _, l := range strings.Split(strings.ReplaceAll(sb.String(), "\r\n ", ""), "\r\n") {
+		if strings.HasPrefix(l, "UID:") {
+			uids = append(uids, l)
+		}
+	}
+	if len(uids) != 2 || uids[0] == uids[1] {
+		t.Errorf("UIDs = %v, want two different ones", uids)
+	}
+}
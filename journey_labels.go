@@ -0,0 +1,123 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"tfltt/tfl/models"
+)
+
+// stationNameSuffixes are trimmed from station names where space is short,
+// e.g. in column headers.
+var stationNameSuffixes = []string{
+	" Underground Station",
+	" DLR Station",
+	" Rail Station",
+	" Tram Stop",
+	" [S]",
+}
+
+// shortStationName trims the mode suffix from a TfL station name.
+func shortStationName(name string) string {
+	for _, suffix := range stationNameSuffixes {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return name
+}
+
+// destinationNote is a footnote marking journeys that do not run to the
+// route's principal destination.
+type destinationNote struct {
+	mark   string
+	stopID string
+	name   string
+}
+
+// footnote explains a destination mark in a page's notes.
+type footnote struct {
+	Mark        string
+	Destination string
+}
+
+// journeyDestination returns the last stop served by journey j according to
+// its station interval.
+func (tr *TimetableRenderer) journeyDestination(j *models.TflAPIPresentationEntitiesKnownJourney) string {
+	offsets, ok := tr.journeyOffsets(j)
+	if !ok {
+		return ""
+	}
+	dest := ""
+	best := -1.0
+	for _, s := range tr.stops {
+		if off, found := offsets[s.id]; found && off >= best {
+			dest, best = s.id, off
+		}
+	}
+	return dest
+}
+
+// principalDestination returns the stop at the end of the route's trunk, the
+// destination of a train running the full route.
+func (tr *TimetableRenderer) principalDestination() string {
+	dest := ""
+	for _, s := range tr.stops {
+		if s.branch == "" {
+			dest = s.id
+		}
+	}
+	return dest
+}
+
+// destinationNotes assigns a footnote mark to every destination other than
+// the principal one, in order of the first journey running there. Marks are
+// stable across pages and filters of the same schedule.
+func (tr *TimetableRenderer) destinationNotes() map[string]destinationNote {
+	principal := tr.principalDestination()
+	notes := make(map[string]destinationNote)
+	for _, j := range tr.journeys {
+		dest := tr.journeyDestination(j)
+		if dest == "" || dest == principal {
+			continue
+		}
+		if _, ok := notes[dest]; !ok {
+			notes[dest] = destinationNote{mark: noteMark(len(notes)), stopID: dest, name: tr.stationNames[dest]}
+		}
+	}
+	return notes
+}
+
+// usedNotes returns the notes referenced by the journeys in blocks, ordered
+// by mark.
+func (tr *TimetableRenderer) usedNotes(notes map[string]destinationNote, blocks [][]*models.TflAPIPresentationEntitiesKnownJourney) []destinationNote {
+	used := make(map[string]bool)
+	var result []destinationNote
+	for _, block := range blocks {
+		for _, j := range block {
+			note, ok := notes[tr.journeyDestination(j)]
+			if ok && !used[note.mark] {
+				used[note.mark] = true
+				result = append(result, note)
+			}
+		}
+	}
+	slices.SortFunc(result, func(a, b destinationNote) int {
+		return compareMarks(a.mark, b.mark)
+	})
+	return result
+}
+
+// noteMark returns the footnote mark of the i-th destination, counting from
+// 0: a to z, then aa, ab and so on.
+func noteMark(i int) string {
+	mark := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		mark = string(rune('a'+(i-1)%26)) + mark
+	}
+	return mark
+}
+
+// compareMarks orders marks in the order noteMark assigns them.
+func compareMarks(a, b string) int {
+	return cmp.Or(cmp.Compare(len(a), len(b)), strings.Compare(a, b))
+}
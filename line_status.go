@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"tfltt/tfl/client"
+	"tfltt/tfl/client/line"
+	"tfltt/tfl/models"
+)
+
+// LineStatusCSS styles line statuses on the status page and the route index.
+const LineStatusCSS = `.status { display: inline-block; padding: 2px 6px; border-radius: 3px; font-weight: bold; font-family: sans-serif; }
+.status.good { background-color: #00782a; color: #fff; }
+.status.info { background-color: #0019a8; color: #fff; }
+.status.minor { background-color: #ffd329; color: #000; }
+.status.severe { background-color: #dc241f; color: #fff; }
+.status.closed { background-color: #636569; color: #fff; }
+table.line-status { border-collapse: collapse; width: 100%; font-family: sans-serif; }
+table.line-status th, table.line-status td { border-bottom: 1px solid #ddd; padding: 6px 8px; text-align: left; vertical-align: top; }
+table.line-status .reason { margin: 4px 0 0; font-size: 0.9em; color: #444; }
+section.disruption { font-family: sans-serif; border-left: 4px solid #dc241f; padding: 0 12px; margin: 1em 0; }
+section.disruption h3 { font-size: 1em; }
+`
+
+// severityClass returns the CSS class for a TfL status severity: "good" for
+// good service, "info" for information-only statuses, "closed" when the
+// service has finished for the day, "severe" for suspensions, closures and
+// severe delays, and "minor" otherwise.
+func severityClass(severity int32) string {
+	switch severity {
+	case 10:
+		return "good"
+	case 18, 19:
+		return "info"
+	case 20:
+		return "closed"
+	case 1, 2, 3, 4, 5, 6, 11, 16:
+		return "severe"
+	default:
+		return "minor"
+	}
+}
+
+// lineStatusAnchor returns the id of a line's section on the status page.
+func lineStatusAnchor(lineID string) string {
+	return "status-" + nonAlphanumeric.ReplaceAllString(strings.ToLower(lineID), "-")
+}
+
+// lineDisrupted reports whether any of l's statuses carries a disruption.
+func lineDisrupted(l *models.TflAPIPresentationEntitiesLine) bool {
+	for _, s := range l.LineStatuses {
+		if s.Disruption != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// statusBadges is a line's status severities for the "status-badges"
+// partial, linking to the line's disruption details at URL if it is set.
+type statusBadges struct {
+	Badges []statusBadge
+	URL    string
+}
+
+// statusBadge is a status severity and its CSS class from severityClass.
+type statusBadge struct {
+	Class string
+	Text  string
+}
+
+// lineStatusBadges returns l's status severities. If detailsURL is not empty
+// and the line is disrupted, the badges link to the disruption details there.
+func lineStatusBadges(l *models.TflAPIPresentationEntitiesLine, detailsURL string) statusBadges {
+	var b statusBadges
+	for _, s := range l.LineStatuses {
+		b.Badges = append(b.Badges, statusBadge{Class: severityClass(s.StatusSeverity), Text: s.StatusSeverityDescription})
+	}
+	if len(b.Badges) == 0 {
+		b.Badges = []statusBadge{{Class: "info", Text: "Unknown"}}
+		return b
+	}
+	if detailsURL != "" && lineDisrupted(l) {
+		b.URL = detailsURL + "#" + lineStatusAnchor(l.ID)
+	}
+	return b
+}
+
+// lineStatusBoard is the data of the "line-status" partial: each line's
+// severities and reasons, followed by the details of every disruption.
+type lineStatusBoard struct {
+	Lines       []lineStatusRow
+	Disruptions []lineDisruptions
+}
+
+// lineStatusRow is a line's status. Anchor is the id of its disruption
+// details, empty if it is not disrupted.
+type lineStatusRow struct {
+	Name    string
+	Badges  statusBadges
+	Reasons []string
+	Anchor  string
+}
+
+// lineDisruptions is the details of a disrupted line's disruptions.
+type lineDisruptions struct {
+	Anchor  string
+	Name    string
+	Notices []disruptionNotice
+}
+
+// newLineStatusBoard returns the status board for lines.
+func newLineStatusBoard(lines []*models.TflAPIPresentationEntitiesLine) lineStatusBoard {
+	var board lineStatusBoard
+	for _, l := range lines {
+		row := lineStatusRow{Name: l.Name, Badges: lineStatusBadges(l, "")}
+		for _, s := range l.LineStatuses {
+			if s.Reason != "" {
+				row.Reasons = append(row.Reasons, s.Reason)
+			}
+		}
+		if !lineDisrupted(l) {
+			board.Lines = append(board.Lines, row)
+			continue
+		}
+		row.Anchor = lineStatusAnchor(l.ID)
+		board.Lines = append(board.Lines, row)
+
+		details := lineDisruptions{Anchor: row.Anchor, Name: l.Name}
+		for _, s := range l.LineStatuses {
+			if d := s.Disruption; d != nil {
+				details.Notices = append(details.Notices, newDisruptionNotice(d, s.StatusSeverityDescription, d.Description, d.AdditionalInfo, d.ClosureText))
+			}
+		}
+		board.Disruptions = append(board.Disruptions, details)
+	}
+	return board
+}
+
+// modesFromQuery reads the mode parameter, which may be repeated or comma
+// separated. It defaults to tube.
+func modesFromQuery(q url.Values) []string {
+	var modes []string
+	for _, v := range q["mode"] {
+		for _, m := range strings.Split(v, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				modes = append(modes, m)
+			}
+		}
+	}
+	if len(modes) == 0 {
+		return []string{"tube"}
+	}
+	return modes
+}
+
+// fetchLineStatuses returns the current status of every line of modes. With
+// detail, disruptions include their affected stops.
+func fetchLineStatuses(tflClient *client.Tfl, modes []string, detail bool) ([]*models.TflAPIPresentationEntitiesLine, error) {
+	params := line.NewLineStatusByModeParams()
+	params.Modes = modes
+	params.Detail = &detail
+	resp, err := tflClient.Line.LineStatusByMode(params)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload, nil
+}
+
+// lineStatusPage is the data of the line status page.
+type lineStatusPage struct {
+	layoutData
+	Modes string
+	Board lineStatusBoard
+}
+
+// LineStatusHandler serves the status of every line of the selected modes.
+func LineStatusHandler(tflClient *client.Tfl) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		modes := modesFromQuery(r.URL.Query())
+
+		lines, err := fetchLineStatuses(tflClient, modes, true)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error getting line status: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		modeNames := make([]string, len(modes))
+		for i, m := range modes {
+			modeNames[i] = modeDisplayName(m)
+		}
+		renderPage(w, http.StatusOK, "line_status", lineStatusPage{
+			layoutData: layoutData{Title: "Line status", CSS: LineStatusCSS},
+			Modes:      strings.Join(modeNames, ", "),
+			Board:      newLineStatusBoard(lines),
+		})
+	}
+}
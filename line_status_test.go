@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"tfltt/tfl/models"
+)
+
+func TestLineStatusBoard(t *testing.T) {
+	lines := []*models.TflAPIPresentationEntitiesLine{
+		{
+			ID:           "bakerloo",
+			Name:         "Bakerloo",
+			LineStatuses: []*models.TflAPIPresentationEntitiesLineStatus{{StatusSeverity: 10, StatusSeverityDescription: "Good Service"}},
+		},
+		{
+			ID:   "metropolitan",
+			Name: "Metropolitan",
+			LineStatuses: []*models.TflAPIPresentationEntitiesLineStatus{{
+				StatusSeverity:            6,
+				StatusSeverityDescription: "Severe Delays",
+				Reason:                    "Metropolitan Line: Severe delays due to a signal failure at <Harrow>.",
+				Disruption: &models.TflAPIPresentationEntitiesDisruption{
+					CategoryDescription: "RealTime",
+					Description:         "Severe delays due to a signal failure.",
+					AffectedStops:       []*models.TflAPIPresentationEntitiesStopPoint{{CommonName: "Harrow-on-the-Hill Underground Station"}},
+				},
+			}},
+		},
+	}
+
+	output := renderTestPartial(t, "line-status", newLineStatusBoard(lines))
+	for _, want := range []string{
+		`<span class="status good">Good Service</span>`,
+		`<span class="status severe">Severe Delays</span>`,
+		`signal failure at &lt;Harrow&gt;.`,
+		`<a href="#status-metropolitan">Disruption details</a>`,
+		`<section class="disruption" id="status-metropolitan"><h2>Metropolitan</h2><h3>RealTime</h3>`,
+		`Affected stops: Harrow-on-the-Hill`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Status board doesn't contain %q", want)
+		}
+	}
+	if strings.Contains(output, `id="status-bakerloo"`) {
+		t.Errorf("Status board has disruption details for a line in good service")
+	}
+
+	if got := renderTestPartial(t, "status-badges", lineStatusBadges(lines[1], "/status?mode=tube")); !strings.HasPrefix(got, `<a href="/status?mode=tube#status-metropolitan">`) {
+		t.Errorf("Badges for a disrupted line = %q, want a link to its details", got)
+	}
+	if got := renderTestPartial(t, "status-badges", lineStatusBadges(lines[0], "/status?mode=tube")); strings.Contains(got, "<a ") {
+		t.Errorf("Badges for a line in good service = %q, want no link", got)
+	}
+}
+
+func TestModesFromQuery(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"tube"}},
+		{"mode=dlr", []string{"dlr"}},
+		{"mode=tube,overground&mode=elizabeth-line", []string{"tube", "overground", "elizabeth-line"}},
+	} {
+		q, _ := url.ParseQuery(tc.query)
+		if got := modesFromQuery(q); !slices.Equal(got, tc.want) {
+			t.Errorf("modesFromQuery(%q) = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
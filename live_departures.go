@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"tfltt/tfl/client"
+	"tfltt/tfl/client/stop_point"
+	"tfltt/tfl/models"
+)
+
+// liveStatus is the real-time state of a scheduled journey at its origin.
+type liveStatus struct {
+	cancelled bool
+	late      time.Duration
+}
+
+// htmlClass returns the CSS class marking a journey column with s.
+func (s liveStatus) htmlClass() string {
+	switch {
+	case s.cancelled:
+		return "live cancelled"
+	case s.late >= time.Minute:
+		return "live late"
+	default:
+		return "live on-time"
+	}
+}
+
+func (s liveStatus) String() string {
+	switch {
+	case s.cancelled:
+		return "Cancelled"
+	case s.late >= time.Minute:
+		return fmt.Sprintf("Late %d min", int(s.late/time.Minute))
+	default:
+		return "On time"
+	}
+}
+
+// serviceDayOf returns midnight at the start of the service day containing t,
+// in t's location.
+func serviceDayOf(t time.Time) time.Time {
+	d := t.Add(-serviceDayStartHour * time.Hour)
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// serviceTimeOn returns t as a ServiceTime of the service day starting at
+// midnight day, counting clock time so that daylight saving changes don't
+// shift it.
+func serviceTimeOn(t, day time.Time) ServiceTime {
+	t = t.In(day.Location())
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	days := date.Sub(time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)) / (24 * time.Hour)
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	return ServiceTime(days*24*time.Hour + clock)
+}
+
+// SetLiveDepartures matches live departures from the origin stop against
+// the journeys the schedule runs today, as of now, by their scheduled
+// departure time. Matched journeys are marked on time, late or cancelled
+// when rendered as HTML. Schedules not running today are left unmarked.
+func (tr *TimetableRenderer) SetLiveDepartures(departures []*models.TflAPIPresentationEntitiesArrivalDeparture, now time.Time) {
+	tr.live = nil
+	day := serviceDayOf(now)
+	if days, ok := scheduleDays(tr.schedule.Name); !ok || !days[day.Weekday()] {
+		return
+	}
+
+	byDeparture := make(map[ServiceTime]*models.TflAPIPresentationEntitiesKnownJourney)
+	for _, j := range tr.journeys {
+		byDeparture[journeyDeparture(j)] = j
+	}
+
+	for _, d := range departures {
+		scheduled := time.Time(d.ScheduledTimeOfDeparture)
+		if scheduled.IsZero() {
+			continue
+		}
+		j, ok := byDeparture[serviceTimeOn(scheduled.Truncate(time.Minute), day)]
+		if !ok {
+			continue
+		}
+		status := liveStatus{cancelled: d.DepartureStatus == "Cancelled" || d.DepartureStatus == "NotStoppingAtStation"}
+		if estimated := time.Time(d.EstimatedTimeOfDeparture); !estimated.IsZero() {
+			status.late = max(estimated.Sub(scheduled), 0)
+		}
+		if tr.live == nil {
+			tr.live = make(map[*models.TflAPIPresentationEntitiesKnownJourney]liveStatus)
+		}
+		tr.live[j] = status
+	}
+}
+
+// fetchLiveDepartures returns the live departures of lineID from stopID, or
+// nil if they are unavailable. Only some modes publish them.
+func fetchLiveDepartures(tflClient *client.Tfl, lineID, stopID string) []*models.TflAPIPresentationEntitiesArrivalDeparture {
+	params := stop_point.NewStopPointArrivalDeparturesParams()
+	params.ID = stopID
+	params.LineIds = []string{lineID}
+	resp, err := tflClient.StopPoint.StopPointArrivalDepartures(params)
+	if err != nil {
+		log.Printf("Error getting live departures for %s at %s: %v", lineID, stopID, err)
+		return nil
+	}
+	return resp.Payload
+}
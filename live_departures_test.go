@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"tfltt/tfl/models"
+
+	"github.com/go-openapi/strfmt"
+)
+
+func TestSetLiveDepartures(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("Failed to load Europe/London: %v", err)
+	}
+	timetable := loadTestTimetable(t, "testdata/rickmansworth_metropolitan_timetable.json")
+
+	// Wednesday 1 May 2024, when the Monday - Thursday schedule runs.
+	now := time.Date(2024, 5, 1, 5, 0, 0, 0, loc)
+	at := func(day, hour, minute int) strfmt.DateTime {
+		return strfmt.DateTime(time.Date(2024, 5, day, hour, minute, 0, 0, loc))
+	}
+	departures := []*models.TflAPIPresentationEntitiesArrivalDeparture{
+		{ScheduledTimeOfDeparture: at(1, 5, 32), EstimatedTimeOfDeparture: at(1, 5, 32), DepartureStatus: "OnTime"},
+		{ScheduledTimeOfDeparture: at(1, 5, 37), EstimatedTimeOfDeparture: at(1, 5, 41), DepartureStatus: "Delayed"},
+		{ScheduledTimeOfDeparture: at(1, 5, 44), DepartureStatus: "Cancelled"},
+		// Past midnight, still in the same service day.
+		{ScheduledTimeOfDeparture: at(2, 0, 33), EstimatedTimeOfDeparture: at(2, 0, 35), DepartureStatus: "Delayed"},
+		// Not in the timetable.
+		{ScheduledTimeOfDeparture: at(1, 5, 33), DepartureStatus: "OnTime"},
+	}
+
+	renderer := newTestRenderer(t, timetable, 0)
+	renderer.SetLiveDepartures(departures, now)
+
+	var got []string
+	for _, j := range renderer.journeys {
+		if status, ok := renderer.live[j]; ok {
+			got = append(got, journeyDeparture(j).Format(TimeFormat{})+" "+status.String())
+		}
+	}
+	want := []string{"05:32 On time", "05:37 Late 4 min", "05:44 Cancelled", "00:33 Late 2 min"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Live statuses = %v, want %v", got, want)
+	}
+
+	output := renderTestPartial(t, "timetable", renderer.timetableView(10))
+	for _, want := range []string{`<span class="live late">Late 4 min</span>`, `<span class="live cancelled">Cancelled</span>`} {
+		if !strings.Contains(output, want) {
+			t.Errorf("HTML doesn't contain %q", want)
+		}
+	}
+
+	// The Sunday schedule doesn't run on a Wednesday.
+	sunday := newTestRenderer(t, timetable, 2)
+	sunday.SetLiveDepartures(departures, now)
+	if len(sunday.live) != 0 {
+		t.Errorf("Sunday schedule matched %d live departures on a Wednesday", len(sunday.live))
+	}
+}
+
+func TestServiceDayOf(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatalf("Failed to load Europe/London: %v", err)
+	}
+	// Before 04:00 belongs to the previous day's service.
+	if got := serviceDayOf(time.Date(2024, 5, 2, 1, 30, 0, 0, loc)); got.Day() != 1 {
+		t.Errorf("serviceDayOf(02 May 01:30) = %v, want 01 May", got)
+	}
+	if got := serviceDayOf(time.Date(2024, 5, 2, 4, 0, 0, 0, loc)); got.Day() != 2 {
+		t.Errorf("serviceDayOf(02 May 04:00) = %v, want 02 May", got)
+	}
+}
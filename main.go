@@ -1,11 +1,16 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"tfltt/tfl/client"
 	"tfltt/tfl/client/line"
@@ -57,7 +62,9 @@ func main() {
 	// Create transport with custom User-Agent and Default Authentication
 	cfg := client.DefaultTransportConfig().WithHost("api.tfl.gov.uk")
 	transport := httptransport.New(cfg.Host, cfg.BasePath, cfg.Schemes)
-	transport.Transport = &UserAgentTransport{Transport: http.DefaultTransport}
+	// Cache responses, persisting them across restarts if TFL_CACHE_DIR is set
+	cache := NewCachingTransport(http.DefaultTransport, os.Getenv("TFL_CACHE_DIR"))
+	transport.Transport = &UserAgentTransport{Transport: cache}
 	transport.DefaultAuthentication = auth
 
 	// Create client
@@ -65,7 +72,17 @@ func main() {
 
 	http.HandleFunc("/{$}", DefaultHandler(tflClient))
 
+	http.HandleFunc("/stops", StopPickerHandler(tflClient))
 	http.HandleFunc("/timetable", TimetableHandler(tflClient))
+	http.HandleFunc("/api/v1/timetable", TimetableAPIHandler(tflClient))
+	http.HandleFunc("/timetable.ics", TimetableICSHandler(tflClient))
+	http.HandleFunc("/stop-poster", StopPosterHandler(tflClient))
+	http.HandleFunc("/gtfs", GTFSHandler(tflClient))
+	http.HandleFunc("/status", LineStatusHandler(tflClient))
+	http.HandleFunc("/board", BoardHandler(tflClient))
+	http.HandleFunc("/board/stream", BoardStreamHandler(newBoardHub(func(stopID string) ([]*models.TflAPIPresentationEntitiesPrediction, error) {
+		return fetchArrivals(tflClient, stopID, "")
+	})))
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -76,64 +93,382 @@ func main() {
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
+// timetablePage is the data of the timetable page.
+type timetablePage struct {
+	layoutData
+	LineID, FromID, ToID string
+	Disruptions          []disruptionNotice
+	ViewSwitch           link
+	Exports              []link
+	Sections             []timetableSection
+}
+
+// timetableSection is one schedule's timetable, or the comparison of a
+// route's schedules, on the timetable page.
+type timetableSection struct {
+	Heading    string
+	Timetable  *timetableView
+	Comparison *comparisonTable
+	Error      string
+	DiagramURL string
+	Pager      *pager
+}
+
 func TimetableHandler(tflClient *client.Tfl) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		lineID := r.URL.Query().Get("line")
 		fromID := r.URL.Query().Get("from")
 		toID := r.URL.Query().Get("to")
 
-		if lineID == "" || fromID == "" || toID == "" {
-			http.Error(w, "Missing required parameters: line, from, to", http.StatusBadRequest)
+		if lineID == "" || fromID == "" {
+			http.Error(w, "Missing required parameters: line, from", http.StatusBadRequest)
 			return
 		}
 
-		params := line.NewLineTimetableToParams()
-		params.ID = lineID
-		params.FromStopPointID = fromID
-		params.ToStopPointID = toID
+		timeFormat := timeFormatFromQuery(r.URL.Query())
+		compact, _ := strconv.ParseBool(r.URL.Query().Get("compact"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		compare := r.URL.Query().Get("view") == "compare"
 
-		timetableResp, err := tflClient.Line.LineTimetableTo(params)
+		filter, err := journeyFilterFromQuery(r.URL.Query())
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error getting timetable: %v", err), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		payload := timetableResp.Payload
-		if payload != nil {
-			var sb strings.Builder
-			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			fmt.Fprintf(w, "<html><body><h1>Timetable for %s from %s to %s</h1>", lineID, fromID, toID)
-
-			if payload.Timetable != nil {
-				for _, route := range payload.Timetable.Routes {
-					for _, schedule := range route.Schedules {
-						renderer, err := NewTimetableRenderer(payload, route, schedule)
-						if err != nil {
-							fmt.Fprintf(&sb, "<p>Error rendering schedule %s: %v</p>", schedule.Name, err)
-							continue
-						}
-						output := renderer.RenderAsText(200, 50)
-						fmt.Fprintf(&sb, "<h2>Schedule: %s</h2><pre>%s</pre>", schedule.Name, output)
+		payload, problem := loadTimetable(tflClient, lineID, fromID, toID)
+		if problem != nil {
+			problem.writePage(w)
+			return
+		}
+
+		// A direction picked from a disambiguation page orders the stops.
+		routeSequence := fetchRouteSequence(tflClient, lineID, cmp.Or(r.URL.Query().Get("direction"), payload.Direction))
+
+		newRenderer := func(route *models.TflAPIPresentationEntitiesTimetableRoute, schedule *models.TflAPIPresentationEntitiesSchedule) (*TimetableRenderer, error) {
+			renderer, err := NewTimetableRenderer(payload, route, schedule)
+			if err != nil {
+				return nil, err
+			}
+			renderer.UseRouteSequence(routeSequence)
+			renderer.SetTimeFormat(timeFormat)
+			renderer.SetCompact(compact)
+			renderer.SetFilter(filter)
+			// Schedules split into different numbers of pages, so a page
+			// past the end of this one shows its last page.
+			renderer.SetPage(min(page, renderer.PageCount(journeysPerPage)))
+			return renderer, nil
+		}
+
+		if format := r.URL.Query().Get("format"); format == "csv" || format == "tsv" || format == "svg" {
+			var renderers []*TimetableRenderer
+			for _, route := range payload.Timetable.Routes {
+				for _, schedule := range route.Schedules {
+					renderer, err := newRenderer(route, schedule)
+					if err != nil {
+						http.Error(w, fmt.Sprintf("Error rendering schedule %s: %v", schedule.Name, err), http.StatusInternalServerError)
+						return
 					}
+					renderers = append(renderers, renderer)
 				}
 			}
+			if format != "svg" {
+				writeCSVExport(w, renderers, format, exportFilename(format, lineID, fromID, toID))
+				return
+			}
 
-			if sb.Len() > 0 {
-				fmt.Fprint(w, sb.String())
-			} else {
-				fmt.Fprint(w, "<p>No schedules found.</p>")
+			index, _ := strconv.Atoi(r.URL.Query().Get("schedule"))
+			if index < 0 || index >= len(renderers) {
+				http.Error(w, fmt.Sprintf("Schedule %d not found", index), http.StatusNotFound)
+				return
 			}
-			fmt.Fprint(w, "</body></html>")
-		} else {
-			http.Error(w, "No timetable payload received", http.StatusNoContent)
+			w.Header().Set("Content-Type", "image/svg+xml")
+			fmt.Fprint(w, renderers[index].RenderAsSvg())
+			return
+		}
+
+		data := timetablePage{
+			layoutData: layoutData{Title: "Timetable for " + lineID, CSS: TimetableCSS},
+			LineID:     lineID,
+			FromID:     fromID,
+			ToID:       toID,
+			ViewSwitch: viewSwitchLink(r.URL, compare),
+			Exports:    exportLinks(r.URL),
+		}
+		disruptions := fetchLineDisruptions(tflClient, lineID)
+		data.Disruptions = disruptionBanner(disruptions)
+
+		var liveDepartures []*models.TflAPIPresentationEntitiesArrivalDeparture
+		now := time.Now()
+		if loc, err := time.LoadLocation("Europe/London"); err == nil {
+			now = now.In(loc)
+		}
+		if !compare {
+			liveDepartures = fetchLiveDepartures(tflClient, lineID, fromID)
+		}
+
+		scheduleIndex := 0
+		for _, route := range payload.Timetable.Routes {
+			var renderers []*TimetableRenderer
+			for _, schedule := range route.Schedules {
+				scheduleIndex++
+				renderer, err := newRenderer(route, schedule)
+				if err != nil {
+					data.Sections = append(data.Sections, timetableSection{Error: fmt.Sprintf("Error rendering schedule %s: %v", schedule.Name, err)})
+					continue
+				}
+				if compare {
+					renderers = append(renderers, renderer)
+					continue
+				}
+				renderer.SetLiveDepartures(liveDepartures, now)
+				renderer.SetDisruptions(disruptions)
+				view := renderer.timetableView(journeysPerPage)
+				data.Sections = append(data.Sections, timetableSection{
+					Heading:    "Schedule: " + schedule.Name,
+					Timetable:  &view,
+					DiagramURL: diagramURL(r.URL, scheduleIndex-1),
+					Pager:      newPager(r.URL, renderer.PageCount(journeysPerPage), renderer.page),
+				})
+			}
+			if compare && len(renderers) > 0 {
+				comparison, err := NewScheduleComparison(renderers)
+				if err != nil {
+					data.Sections = append(data.Sections, timetableSection{Error: fmt.Sprintf("Error comparing schedules: %v", err)})
+					continue
+				}
+				table := comparison.htmlTable()
+				data.Sections = append(data.Sections, timetableSection{
+					Heading:    "Schedule comparison",
+					Comparison: &table,
+				})
+			}
+		}
+
+		renderPage(w, http.StatusOK, "timetable", data)
+	}
+}
+
+// fetchTimetable returns the timetable of lineID from fromID to toID. If toID
+// is empty, TfL picks the direction from fromID.
+func fetchTimetable(tflClient *client.Tfl, lineID, fromID, toID string) (*models.TflAPIPresentationEntitiesTimetableResponse, error) {
+	if toID == "" {
+		params := line.NewLineTimetableParams()
+		params.ID = lineID
+		params.FromStopPointID = fromID
+		resp, err := tflClient.Line.LineTimetable(params)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Payload, nil
+	}
+
+	params := line.NewLineTimetableToParams()
+	params.ID = lineID
+	params.FromStopPointID = fromID
+	params.ToStopPointID = toID
+	resp, err := tflClient.Line.LineTimetableTo(params)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Payload, nil
+}
+
+// loadTimetable fetches a timetable like fetchTimetable, and returns the
+// problem to report instead if the response has no timetable to show.
+func loadTimetable(tflClient *client.Tfl, lineID, fromID, toID string) (*models.TflAPIPresentationEntitiesTimetableResponse, *timetableProblem) {
+	payload, err := fetchTimetable(tflClient, lineID, fromID, toID)
+	if err != nil {
+		return nil, &timetableProblem{Status: http.StatusBadGateway, Message: fmt.Sprintf("Error getting timetable: %v", err)}
+	}
+	if payload == nil {
+		return nil, &timetableProblem{Status: http.StatusBadGateway, Message: "No timetable payload received"}
+	}
+	if payload.Timetable == nil {
+		if p := payloadProblem(payload); p != nil {
+			return nil, p
 		}
+		return nil, &timetableProblem{Status: http.StatusNotFound, Message: "No timetable found"}
 	}
+	return payload, nil
+}
+
+// fetchRouteSequence returns the line's route sequence in direction, or nil
+// if it is unavailable. The route sequence refines stop ordering on branched
+// lines; timetables are still usable without it.
+func fetchRouteSequence(tflClient *client.Tfl, lineID, direction string) *models.TflAPIPresentationEntitiesRouteSequence {
+	if direction == "" {
+		return nil
+	}
+	params := line.NewLineRouteSequenceParams()
+	params.ID = lineID
+	params.Direction = direction
+	resp, err := tflClient.Line.LineRouteSequence(params)
+	if err != nil {
+		log.Printf("Error getting route sequence for %s: %v", lineID, err)
+		return nil
+	}
+	return resp.Payload
+}
+
+// viewSwitchLink links between the per-schedule timetables and the schedule
+// comparison view of the same route.
+func viewSwitchLink(u *url.URL, compare bool) link {
+	q := u.Query()
+	if compare {
+		q.Del("view")
+		return link{Label: "Show full timetables", URL: u.Path + "?" + q.Encode()}
+	}
+	q.Set("view", "compare")
+	return link{Label: "Compare schedules", URL: u.Path + "?" + q.Encode()}
+}
+
+// exportLinks links to the CSV, TSV and iCalendar exports of the current
+// timetable.
+func exportLinks(u *url.URL) []link {
+	var links []link
+	for _, format := range []string{"csv", "tsv"} {
+		q := u.Query()
+		q.Del("page")
+		q.Set("format", format)
+		links = append(links, link{Label: strings.ToUpper(format), URL: u.Path + "?" + q.Encode()})
+	}
+	q := u.Query()
+	q.Del("page")
+	return append(links, link{Label: "iCalendar", URL: "/timetable.ics?" + q.Encode()})
+}
+
+// diagramURL links to the string-line diagram of the schedule with the given
+// index, over the current time window.
+func diagramURL(u *url.URL, index int) string {
+	q := u.Query()
+	q.Del("page")
+	q.Set("format", "svg")
+	q.Set("schedule", strconv.Itoa(index))
+	return u.Path + "?" + q.Encode()
+}
+
+// journeysPerPage is the number of journey columns in each block of the
+// timetable page.
+const journeysPerPage = 40
+
+// pager links to each page of a timetable, and to every page at once.
+type pager struct {
+	Pages []link
+	All   link
+}
+
+// newPager returns the pager of a timetable with pageCount pages, or nil if
+// there is only one.
+func newPager(u *url.URL, pageCount, current int) *pager {
+	if pageCount <= 1 {
+		return nil
+	}
+	pageLink := func(page int, label string) link {
+		q := u.Query()
+		q.Set("page", strconv.Itoa(page))
+		return link{Label: label, URL: u.Path + "?" + q.Encode(), Current: page == current}
+	}
+
+	p := &pager{All: pageLink(0, "All")}
+	for i := 1; i <= pageCount; i++ {
+		p.Pages = append(p.Pages, pageLink(i, strconv.Itoa(i)))
+	}
+	return p
+}
+
+// journeyFilterFromQuery reads the optional after, before, stop and count
+// parameters. from_time and to_time are accepted as aliases of after and
+// before.
+func journeyFilterFromQuery(q url.Values) (JourneyFilter, error) {
+	var f JourneyFilter
+	for _, p := range []struct {
+		names []string
+		dst   *ServiceTime
+	}{
+		{[]string{"after", "from_time"}, &f.After},
+		{[]string{"before", "to_time"}, &f.Before},
+	} {
+		for _, name := range p.names {
+			v := q.Get(name)
+			if v == "" {
+				continue
+			}
+			t, err := parseClockTime(v)
+			if err != nil {
+				return f, fmt.Errorf("Invalid %s: %v", name, err)
+			}
+			*p.dst = t
+			break
+		}
+	}
+	if v := q.Get("count"); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil || count < 0 {
+			return f, fmt.Errorf("Invalid count: %q", v)
+		}
+		f.Count = count
+	}
+	f.StopID = q.Get("stop")
+	return f, nil
+}
+
+// timeFormatFromQuery reads the optional extended_hours and seconds flags.
+func timeFormatFromQuery(q url.Values) TimeFormat {
+	extended, _ := strconv.ParseBool(q.Get("extended_hours"))
+	seconds, _ := strconv.ParseBool(q.Get("seconds"))
+	return TimeFormat{ExtendedHours: extended, Seconds: seconds}
+}
+
+// IndexCSS styles the index page.
+const IndexCSS = `table { border-collapse: collapse; width: 100%; } th, td { border: 1px solid black; padding: 8px; text-align: left; } th { background-color: #f2f2f2; }
+` + LineStatusCSS + modeTabsCSS
+
+// indexPage is the data of the index page.
+type indexPage struct {
+	layoutData
+	Modes     []link
+	ModeName  string
+	StatusURL string
+	Lines     []indexLine
+}
+
+// indexLine is a line on the index page, with a row for each of its routes.
+// Status is nil if unavailable.
+type indexLine struct {
+	Name     string
+	StopsURL string
+	Status   *statusBadges
+	Routes   []indexRoutes
+}
+
+// indexRoutes links to the timetables of a route in each direction. Either
+// may be nil.
+type indexRoutes struct {
+	Outbound *link
+	Inbound  *link
 }
 
 func DefaultHandler(tflClient *client.Tfl) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = defaultMode
+		}
+
+		modes, err := fetchScheduledModes(tflClient)
+		if err != nil {
+			log.Printf("Error getting modes: %v", err)
+			// Without the list of modes only the default is known to exist.
+			modes = []string{defaultMode}
+		}
+		if !slices.Contains(modes, mode) {
+			http.Error(w, fmt.Sprintf("Unknown mode: %s", mode), http.StatusNotFound)
+			return
+		}
+
 		params := line.NewLineRouteByModeParams()
-		params.Modes = []string{"tube"}
+		params.Modes = []string{mode}
 
 		resp, err := tflClient.Line.LineRouteByMode(params)
 		if err != nil {
@@ -141,12 +476,22 @@ func DefaultHandler(tflClient *client.Tfl) http.HandlerFunc {
 			return
 		}
 
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		fmt.Fprint(w, "<html><head><style>table { border-collapse: collapse; width: 100%; } th, td { border: 1px solid black; padding: 8px; text-align: left; } th { background-color: #f2f2f2; }</style></head><body>")
-		fmt.Fprint(w, "<h1>Tube Lines and Routes</h1>")
-		fmt.Fprint(w, "<table>")
-		fmt.Fprint(w, "<thead><tr><th>Line</th><th>Outbound</th><th>Inbound</th></tr></thead>")
-		fmt.Fprint(w, "<tbody>")
+		statuses := make(map[string]*models.TflAPIPresentationEntitiesLine)
+		if lines, err := fetchLineStatuses(tflClient, params.Modes, false); err != nil {
+			log.Printf("Error getting line status: %v", err)
+		} else {
+			for _, l := range lines {
+				statuses[l.ID] = l
+			}
+		}
+		statusURL := "/status?" + url.Values{"mode": params.Modes}.Encode()
+
+		data := indexPage{
+			layoutData: layoutData{Title: modeDisplayName(mode) + " lines and routes", CSS: IndexCSS},
+			Modes:      modeTabs(modes, mode),
+			ModeName:   modeDisplayName(mode),
+			StatusURL:  statusURL,
+		}
 
 		for _, l := range resp.Payload {
 			// Group routes by segment (Origin <-> Destination)
@@ -184,35 +529,26 @@ func DefaultHandler(tflClient *client.Tfl) http.HandlerFunc {
 				}
 			}
 
-			// Render rows for this line
-			firstRow := true
+			row := indexLine{
+				Name:     l.Name,
+				StopsURL: "/stops?" + url.Values{"line": {l.ID}}.Encode(),
+			}
+			if status, ok := statuses[l.ID]; ok {
+				badges := lineStatusBadges(status, statusURL)
+				row.Status = &badges
+			}
+			routeLink := func(route *models.TflAPIPresentationEntitiesMatchedRoute) *link {
+				if route == nil {
+					return nil
+				}
+				return &link{Label: route.Name, URL: timetableURL(l.ID, route.Originator, route.Destination)}
+			}
 			for _, key := range segmentKeys {
 				pair := segments[key]
-				fmt.Fprint(w, "<tr>")
-				if firstRow {
-					fmt.Fprintf(w, "<td rowspan='%d'>%s</td>", len(segmentKeys), l.Name)
-					firstRow = false
-				}
-
-				// Outbound Cell
-				fmt.Fprint(w, "<td>")
-				if pair.Outbound != nil {
-					href := fmt.Sprintf("/timetable?line=%s&from=%s&to=%s", l.ID, pair.Outbound.Originator, pair.Outbound.Destination)
-					fmt.Fprintf(w, "<a href='%s'>%s</a>", href, pair.Outbound.Name)
-				}
-				fmt.Fprint(w, "</td>")
-
-				// Inbound Cell
-				fmt.Fprint(w, "<td>")
-				if pair.Inbound != nil {
-					href := fmt.Sprintf("/timetable?line=%s&from=%s&to=%s", l.ID, pair.Inbound.Originator, pair.Inbound.Destination)
-					fmt.Fprintf(w, "<a href='%s'>%s</a>", href, pair.Inbound.Name)
-				}
-				fmt.Fprint(w, "</td>")
-
-				fmt.Fprint(w, "</tr>")
+				row.Routes = append(row.Routes, indexRoutes{Outbound: routeLink(pair.Outbound), Inbound: routeLink(pair.Inbound)})
 			}
+			data.Lines = append(data.Lines, row)
 		}
-		fmt.Fprint(w, "</tbody></table></body></html>")
+		renderPage(w, http.StatusOK, "index", data)
 	}
 }
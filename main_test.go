@@ -2,11 +2,19 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"slices"
 	"strings"
 	"testing"
+
+	"tfltt/tfl/client"
 	"tfltt/tfl/models"
+
+	httptransport "github.com/go-openapi/runtime/client"
+	"github.com/go-openapi/strfmt"
 )
 
 func TestRenderTimetableTable(t *testing.T) {
@@ -43,27 +51,341 @@ func TestRenderTimetableTable(t *testing.T) {
 			if len(timetable.Timetable.Routes) == 0 || len(timetable.Timetable.Routes[0].Schedules) == 0 {
 				t.Fatalf("Test data missing routes or schedules")
 			}
-			route := timetable.Timetable.Routes[0]
-			schedule := route.Schedules[0]
 
-			renderer, err := NewTimetableRenderer(&timetable, route, schedule)
-			if err != nil {
-				t.Fatalf("Failed to create renderer: %v", err)
-			}
+			renderer := newTestRenderer(t, &timetable, 0)
 			output := renderer.RenderAsText(20, 35)
-			fmt.Printf("--- Table Test Output Start (%s) ---\n", tc.name)
-			fmt.Println(output)
-			fmt.Printf("--- Table Test Output End (%s) ---\n", tc.name)
+			if !strings.Contains(output, "Schedule: "+timetable.Timetable.Routes[0].Schedules[0].Name) {
+				t.Errorf("Text output doesn't name the schedule")
+			}
 
-			if len(output) < 100 {
-				t.Errorf("Output too short, likely failed to render properly")
+			// Without a page, every page is rendered, each at most 20
+			// journeys wide.
+			var headers []string
+			tables, _, _ := strings.Cut(output, "\nFirst and last trains")
+			for _, line := range strings.Split(tables, "\n") {
+				if strings.HasPrefix(line, "Station ") {
+					headers = append(headers, line)
+				}
+			}
+			if got, want := len(headers), renderer.PageCount(20); got != want || want < 2 {
+				t.Errorf("Text output has %d tables, want %d", got, want)
+			}
+			for _, h := range headers {
+				if n := strings.Count(h, " | "); n == 0 || n > 20 {
+					t.Errorf("Text table has %d journeys, want 1 to 20", n)
+				}
 			}
 
-			// Verify HTML placeholder
-			htmlOutput := renderer.RenderAsHtml(20)
-			if !strings.Contains(htmlOutput, "<html>") {
-				t.Errorf("HTML output doesn't look like HTML")
+			// Verify HTML table
+			renderer.SetPage(1)
+			htmlOutput := renderTestPartial(t, "timetable", renderer.timetableView(20))
+			if !strings.Contains(htmlOutput, "<table class=\"timetable\">") {
+				t.Errorf("HTML output doesn't contain a timetable table")
+			}
+			mainTable, _, _ := strings.Cut(htmlOutput, "first-last")
+			if got, want := strings.Count(mainTable, "<th class=\"station\" scope=\"row\">"), len(renderer.stops); got != want {
+				t.Errorf("HTML output has %d station rows, want %d", got, want)
+			}
+		})
+	}
+}
+
+func loadTestTimetable(t *testing.T, dataFile string) *models.TflAPIPresentationEntitiesTimetableResponse {
+	t.Helper()
+	data, err := os.ReadFile(dataFile)
+	if err != nil {
+		t.Fatalf("Failed to read test data %s: %v", dataFile, err)
+	}
+	var timetable models.TflAPIPresentationEntitiesTimetableResponse
+	if err := json.Unmarshal(data, &timetable); err != nil {
+		t.Fatalf("Failed to unmarshal test data: %v", err)
+	}
+	return &timetable
+}
+
+// newTestRenderer returns a renderer for the schedule at index schedule of
+// the first route of timetable.
+func newTestRenderer(t *testing.T, timetable *models.TflAPIPresentationEntitiesTimetableResponse, schedule int) *TimetableRenderer {
+	t.Helper()
+	route := timetable.Timetable.Routes[0]
+	renderer, err := NewTimetableRenderer(timetable, route, route.Schedules[schedule])
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+	return renderer
+}
+
+// metropolitanRouteSequence returns an outbound Amersham to Aldgate route
+// sequence, which covers stops upstream of Rickmansworth that its timetable
+// never serves.
+func metropolitanRouteSequence(t *testing.T) *models.TflAPIPresentationEntitiesRouteSequence {
+	t.Helper()
+	full := newTestRenderer(t, loadTestTimetable(t, "testdata/amersham_metropolitan_timetable.json"), 0)
+	rs := &models.TflAPIPresentationEntitiesRouteSequence{
+		OrderedLineRoutes:  []*models.TflAPIPresentationEntitiesOrderedRoute{{}},
+		StopPointSequences: []*models.TflAPIPresentationEntitiesStopPointSequence{{Direction: "outbound", BranchID: 1}},
+	}
+	for _, s := range full.stops {
+		stop := &models.TflAPIPresentationEntitiesMatchedStop{ID: s.id, Name: s.name}
+		rs.OrderedLineRoutes[0].NaptanIds = append(rs.OrderedLineRoutes[0].NaptanIds, s.id)
+		rs.StopPointSequences[0].StopPoint = append(rs.StopPointSequences[0].StopPoint, stop)
+		rs.Stations = append(rs.Stations, stop)
+	}
+	return rs
+}
+
+func TestTimetableViewEscapesStationNames(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/amersham_metropolitan_timetable.json")
+	timetable.Stops[0].Name = "<script>alert(1)</script>"
+
+	renderer := newTestRenderer(t, timetable, 0)
+	output := renderTestPartial(t, "timetable", renderer.timetableView(5))
+	if strings.Contains(output, "<script>") {
+		t.Errorf("HTML output contains unescaped station name")
+	}
+	if !strings.Contains(output, "&lt;script&gt;") {
+		t.Errorf("HTML output doesn't contain escaped station name")
+	}
+	if !strings.Contains(output, "class=\"no-call\"") {
+		t.Errorf("HTML output doesn't mark stops that are not called at")
+	}
+}
+
+func TestStopOrderKeepsBranchesTogether(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/rickmansworth_metropolitan_timetable.json")
+
+	renderer := newTestRenderer(t, timetable, 0)
+
+	var ids []string
+	for _, s := range renderer.stops {
+		ids = append(ids, s.id)
+	}
+	n := len(ids)
+	if n < 3 || ids[0] != "940GZZLURKW" || ids[n-2] != "940GZZLUCXY" || ids[n-1] != "940GZZLUWAF" {
+		t.Errorf("Watford branch not ordered after the trunk: %v", ids)
+	}
+	for _, s := range renderer.stops {
+		onBranch := s.id == "940GZZLUCXY" || s.id == "940GZZLUWAF"
+		if onBranch != (s.branch != "") {
+			t.Errorf("Stop %s has branch %q", s.id, s.branch)
+		}
+	}
+	if !strings.Contains(renderTestPartial(t, "timetable", renderer.timetableView(5)), "Branch to Watford Underground Station") {
+		t.Errorf("HTML output doesn't label the Watford branch")
+	}
+}
+
+func TestStopGraphMergesSkipStopSequences(t *testing.T) {
+	g := newStopGraph()
+	// A fast service seen first must not push the stopping service's
+	// intermediate stops to the end.
+	g.addSequence([]string{"A", "B", "E"})
+	g.addSequence([]string{"A", "B", "C", "D", "E"})
+	g.addSequence([]string{"A", "B", "X"})
+
+	got := strings.Join(g.order("A"), ",")
+	if want := "A,B,C,D,E,X"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+	branches := g.branches(g.order("A"))
+	if len(branches) != 1 || branches["X"] != "X" {
+		t.Errorf("branches = %v, want only X", branches)
+	}
+}
+
+func TestFirstLastTrainsIncludeTruncatedJourneys(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/amersham_metropolitan_timetable.json")
+
+	renderer := newTestRenderer(t, timetable, 0)
+	fl := renderer.firstLastTrains()
+	if fl[0].stop.id != "940GZZLUAMS" || !fl[0].calls {
+		t.Fatalf("Unexpected first stop %+v", fl[0])
+	}
+	if got := fl[0].first.Format(TimeFormat{}); got != "05:22" {
+		t.Errorf("First train from Amersham = %s, want 05:22", got)
+	}
+	if got := fl[0].last.Format(TimeFormat{ExtendedHours: true}); got != "24:50" {
+		t.Errorf("Last train from Amersham = %s, want 24:50", got)
+	}
+
+	// The last train is shown even though the table is truncated.
+	if output := renderer.RenderAsText(5, 35); !strings.Contains(output, "00:50") {
+		t.Errorf("Text output doesn't include the last train")
+	}
+}
+
+func TestJourneyColumnsLabelShortWorkings(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/rickmansworth_metropolitan_timetable.json")
+
+	renderer := newTestRenderer(t, timetable, 0)
+	if got := renderer.principalDestination(); got != "940GZZLUALD" {
+		t.Errorf("principalDestination = %s, want Aldgate", got)
+	}
+
+	notes := renderer.destinationNotes()
+	watford, ok := notes["940GZZLUWAF"]
+	if !ok || watford.mark != "a" {
+		t.Fatalf("Watford note = %+v, want mark a", watford)
+	}
+	if _, ok := notes["940GZZLUALD"]; ok {
+		t.Errorf("Trains to the principal destination shouldn't carry a note")
+	}
+
+	renderer.SetPage(1)
+	output := renderTestPartial(t, "timetable", renderer.timetableView(5))
+	if !strings.Contains(output, "05:32<br><span class=\"destination\">Watford</span><sup class=\"note\">a</sup>") {
+		t.Errorf("HTML output doesn't label the 05:32 to Watford")
+	}
+	if !strings.Contains(output, "<dt>a</dt><dd>Terminates at Watford Underground Station</dd>") {
+		t.Errorf("HTML output doesn't include the Watford footnote")
+	}
+}
+
+func TestNoteMark(t *testing.T) {
+	for i, want := range map[int]string{0: "a", 25: "z", 26: "aa", 27: "ab", 51: "az", 52: "ba", 701: "zz", 702: "aaa"} {
+		if got := noteMark(i); got != want {
+			t.Errorf("noteMark(%d) = %q, want %q", i, got, want)
+		}
+	}
+	if compareMarks("b", "aa") >= 0 || compareMarks("aa", "ab") >= 0 || compareMarks("z", "z") != 0 {
+		t.Errorf("compareMarks doesn't order marks as assigned")
+	}
+}
+
+func TestUseRouteSequenceFromIntermediateStop(t *testing.T) {
+	rs := metropolitanRouteSequence(t)
+
+	timetable := loadTestTimetable(t, "testdata/rickmansworth_metropolitan_timetable.json")
+	renderer := newTestRenderer(t, timetable, 0)
+	stopIDs := func() []string {
+		var ids []string
+		for _, s := range renderer.stops {
+			ids = append(ids, s.id)
+		}
+		return ids
+	}
+	want := stopIDs()
+
+	renderer.UseRouteSequence(rs)
+	got := stopIDs()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Stop order with route sequence = %v, want %v", got, want)
+	}
+	for _, id := range []string{"940GZZLUAMS", "940GZZLUCAL", "940GZZLUCYD"} {
+		if slices.Contains(got, id) {
+			t.Errorf("Stop %s upstream of Rickmansworth is in the table", id)
+		}
+	}
+	if got := renderer.principalDestination(); got != "940GZZLUALD" {
+		t.Errorf("principalDestination = %s, want Aldgate", got)
+	}
+	if _, ok := renderer.destinationNotes()["940GZZLUALD"]; ok {
+		t.Errorf("Trains to Aldgate carry a footnote")
+	}
+}
+
+// fixtureTransport answers TfL requests from files in testdata, by path, and
+// with 404 for any other path.
+type fixtureTransport map[string]string
+
+func (f fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	status, body := http.StatusNotFound, []byte(`{"message":"not found"}`)
+	if file, ok := f[req.URL.Path]; ok {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		status, body = http.StatusOK, data
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(string(body))),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func newFixtureClient(files fixtureTransport) *client.Tfl {
+	transport := httptransport.New("api.tfl.gov.uk", "/", []string{"https"})
+	transport.Transport = files
+	return client.New(transport, strfmt.Default)
+}
+
+func TestTimetableHandlersWithoutTo(t *testing.T) {
+	tflClient := newFixtureClient(fixtureTransport{
+		"/Line/metropolitan/Timetable/940GZZLUAMS": "testdata/amersham_metropolitan_timetable.json",
+	})
+	testCases := []struct {
+		name    string
+		handler http.HandlerFunc
+		url     string
+	}{
+		{"api", TimetableAPIHandler(tflClient), "/api/v1/timetable?line=metropolitan&from=940GZZLUAMS"},
+		{"ics", TimetableICSHandler(tflClient), "/timetable.ics?line=metropolitan&from=940GZZLUAMS"},
+		{"poster", StopPosterHandler(tflClient), "/stop-poster?line=metropolitan&from=940GZZLUAMS"},
+		{"gtfs", GTFSHandler(tflClient), "/gtfs?route=metropolitan:940GZZLUAMS"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tc.handler(rec, httptest.NewRequest(http.MethodGet, tc.url, nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("Status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
 			}
 		})
 	}
 }
+
+func TestTimetableHandlersReportProblems(t *testing.T) {
+	tflClient := newFixtureClient(fixtureTransport{})
+
+	rec := httptest.NewRecorder()
+	TimetableAPIHandler(tflClient)(rec, httptest.NewRequest(http.MethodGet, "/api/v1/timetable?line=metropolitan&from=940GZZLUAMS", nil))
+	var apiErr apiError
+	if err := json.Unmarshal(rec.Body.Bytes(), &apiErr); err != nil || rec.Code != http.StatusBadGateway || !strings.HasPrefix(apiErr.Error, "Error getting timetable") {
+		t.Errorf("API gave %d %s, want %d and a JSON error", rec.Code, rec.Body.String(), http.StatusBadGateway)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/timetable", TimetableHandler(tflClient))
+	mux.HandleFunc("/timetable.ics", TimetableICSHandler(tflClient))
+	mux.HandleFunc("/stop-poster", StopPosterHandler(tflClient))
+	for _, url := range []string{
+		"/timetable?line=metropolitan&from=940GZZLUAMS",
+		"/timetable.ics?line=metropolitan&from=940GZZLUAMS",
+		"/stop-poster?line=metropolitan&from=940GZZLUAMS",
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "<h1>Timetable not found</h1>") {
+			t.Errorf("%s gave %d %s, want %d and the problem page", url, rec.Code, rec.Body.String(), http.StatusBadGateway)
+		}
+	}
+
+	// The GTFS feed is a zip, so it reports problems as plain text.
+	rec = httptest.NewRecorder()
+	GTFSHandler(tflClient)(rec, httptest.NewRequest(http.MethodGet, "/gtfs?route=metropolitan:940GZZLUAMS", nil))
+	if rec.Code != http.StatusBadGateway || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("GTFS gave %d %s %q, want %d and plain text", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String(), http.StatusBadGateway)
+	}
+}
+
+func TestTimetableHandlerClampsPagePerSchedule(t *testing.T) {
+	tflClient := newFixtureClient(fixtureTransport{
+		"/Line/metropolitan/Timetable/940GZZLUAMS": "testdata/amersham_metropolitan_timetable.json",
+	})
+	rec := httptest.NewRecorder()
+	TimetableHandler(tflClient)(rec, httptest.NewRequest(http.MethodGet, "/timetable?line=metropolitan&from=940GZZLUAMS&page=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// Only the weekday schedules run to a second page; the weekend ones show
+	// their only page rather than nothing.
+	timetable := loadTestTimetable(t, "testdata/amersham_metropolitan_timetable.json")
+	schedules := timetable.Timetable.Routes[0].Schedules
+	if got := strings.Count(rec.Body.String(), `<table class="timetable">`); got != len(schedules) {
+		t.Errorf("Page 2 has %d tables, want one per schedule (%d)", got, len(schedules))
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"tfltt/tfl/client"
+	"tfltt/tfl/client/line"
+)
+
+// defaultMode is the mode the index page shows first.
+const defaultMode = "tube"
+
+// modeDisplayNames overrides the names derived from TfL mode identifiers.
+var modeDisplayNames = map[string]string{
+	"dlr":            "DLR",
+	"elizabeth-line": "Elizabeth line",
+	"national-rail":  "National Rail",
+	"overground":     "London Overground",
+}
+
+// modeDisplayName returns a human-readable name for a TfL mode identifier,
+// e.g. "Cable car" for "cable-car".
+func modeDisplayName(mode string) string {
+	if name, ok := modeDisplayNames[mode]; ok {
+		return name
+	}
+	name := strings.ReplaceAll(mode, "-", " ")
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// fetchScheduledModes returns the identifiers of the modes TfL publishes
+// timetables for, in TfL's order.
+func fetchScheduledModes(tflClient *client.Tfl) ([]string, error) {
+	resp, err := tflClient.Line.LineMetaModes(line.NewLineMetaModesParams())
+	if err != nil {
+		return nil, err
+	}
+	var modes []string
+	for _, m := range resp.Payload {
+		if m.IsScheduledService && !slices.Contains(modes, m.ModeName) {
+			modes = append(modes, m.ModeName)
+		}
+	}
+	return modes, nil
+}
+
+// modeTabs returns a tab for each mode, linking to the index page for that
+// mode, with current selected.
+func modeTabs(modes []string, current string) []link {
+	var tabs []link
+	for _, m := range modes {
+		tabs = append(tabs, link{
+			Label:   modeDisplayName(m),
+			URL:     "/?" + url.Values{"mode": {m}}.Encode(),
+			Current: m == current,
+		})
+	}
+	return tabs
+}
+
+// modeTabsCSS styles the mode tabs of the index page.
+const modeTabsCSS = `nav.modes { font-family: sans-serif; border-bottom: 2px solid #000; margin-bottom: 1em; }
+nav.modes a, nav.modes strong { display: inline-block; padding: 6px 12px; border: 1px solid #ccc; border-bottom: none; border-radius: 4px 4px 0 0; margin-right: 2px; text-decoration: none; }
+nav.modes strong { background-color: #000; color: #fff; border-color: #000; }
+`
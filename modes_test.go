@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestModeDisplayName(t *testing.T) {
+	for mode, want := range map[string]string{
+		"tube":           "Tube",
+		"dlr":            "DLR",
+		"elizabeth-line": "Elizabeth line",
+		"cable-car":      "Cable car",
+		"":               "",
+	} {
+		if got := modeDisplayName(mode); got != want {
+			t.Errorf("modeDisplayName(%q) = %q, want %q", mode, got, want)
+		}
+	}
+}
+
+func TestModeTabs(t *testing.T) {
+	tabs := modeTabs([]string{"tube", "dlr", "elizabeth-line"}, "dlr")
+	want := []link{
+		{Label: "Tube", URL: "/?mode=tube"},
+		{Label: "DLR", URL: "/?mode=dlr", Current: true},
+		{Label: "Elizabeth line", URL: "/?mode=elizabeth-line"},
+	}
+	if !slices.Equal(tabs, want) {
+		t.Errorf("modeTabs = %+v, want %+v", tabs, want)
+	}
+}
+
+func TestDefaultHandlerRejectsUnknownModeWithoutModes(t *testing.T) {
+	// The fixture client has no files, so fetching the modes fails.
+	handler := DefaultHandler(newFixtureClient(fixtureTransport{}))
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/?mode=bogus", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
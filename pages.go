@@ -0,0 +1,90 @@
+package main
+
+import (
+	"slices"
+
+	"tfltt/tfl/models"
+)
+
+// JourneyFilter restricts which journeys are rendered. A zero value selects
+// every journey.
+type JourneyFilter struct {
+	// After and Before bound, inclusively, the time a journey departs the
+	// origin stop or, when StopID is set, calls at StopID. A zero bound is open.
+	After  ServiceTime
+	Before ServiceTime
+	// StopID, if set, filters on the time journeys call at this stop instead
+	// of their departure; journeys not calling there are excluded.
+	StopID string
+	// Count, if positive, keeps only the first Count matching journeys.
+	Count int
+}
+
+func (f JourneyFilter) contains(t ServiceTime) bool {
+	return (f.After == 0 || t >= f.After) && (f.Before == 0 || t <= f.Before)
+}
+
+// SetFilter restricts the journeys rendered by every output format.
+func (tr *TimetableRenderer) SetFilter(f JourneyFilter) {
+	tr.filter = f
+}
+
+// SetPage selects a single block of journeys to render, counting from 1.
+// Page 0 renders every block.
+func (tr *TimetableRenderer) SetPage(page int) {
+	tr.page = page
+}
+
+// PageCount returns the number of blocks the selected journeys split into
+// with at most journeysPerPage columns each.
+func (tr *TimetableRenderer) PageCount(journeysPerPage int) int {
+	return len(tr.paginate(journeysPerPage))
+}
+
+// selectedJourneys returns the journeys matching the renderer's filter.
+func (tr *TimetableRenderer) selectedJourneys() []*models.TflAPIPresentationEntitiesKnownJourney {
+	var selected []*models.TflAPIPresentationEntitiesKnownJourney
+	for _, j := range tr.journeys {
+		t := journeyDeparture(j)
+		if tr.filter.StopID != "" {
+			var ok bool
+			if t, ok = tr.arrivalAt(j, tr.filter.StopID); !ok {
+				continue
+			}
+		}
+		if !tr.filter.contains(t) {
+			continue
+		}
+		selected = append(selected, j)
+		if tr.filter.Count > 0 && len(selected) == tr.filter.Count {
+			break
+		}
+	}
+	return selected
+}
+
+// paginate splits the selected journeys into blocks of at most
+// journeysPerPage journeys. A non-positive journeysPerPage gives one block.
+func (tr *TimetableRenderer) paginate(journeysPerPage int) [][]*models.TflAPIPresentationEntitiesKnownJourney {
+	journeys := tr.selectedJourneys()
+	if len(journeys) == 0 {
+		return nil
+	}
+	if journeysPerPage <= 0 {
+		return [][]*models.TflAPIPresentationEntitiesKnownJourney{journeys}
+	}
+	return slices.Collect(slices.Chunk(journeys, journeysPerPage))
+}
+
+// blocks returns the blocks of journeys to render: the selected page, or all
+// of them when no page is selected.
+func (tr *TimetableRenderer) blocks(journeysPerPage int) [][]*models.TflAPIPresentationEntitiesKnownJourney {
+	pages := tr.paginate(journeysPerPage)
+	if tr.page <= 0 {
+		return pages
+	}
+	if tr.page > len(pages) {
+		return nil
+	}
+	return pages[tr.page-1 : tr.page]
+}
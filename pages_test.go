@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPaginationKeepsEveryJourney(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/richmond_district_timetable.json")
+	route := timetable.Timetable.Routes[0]
+	schedule := route.Schedules[0]
+
+	renderer := newTestRenderer(t, timetable, 0)
+
+	const perPage = 40
+	pages := renderer.PageCount(perPage)
+	if want := (len(schedule.KnownJourneys) + perPage - 1) / perPage; pages != want {
+		t.Fatalf("PageCount = %d, want %d", pages, want)
+	}
+
+	total := 0
+	for page := 1; page <= pages; page++ {
+		renderer.SetPage(page)
+		html := renderTestPartial(t, "timetable", renderer.timetableView(perPage))
+		header, _, _ := strings.Cut(html, "</thead>")
+		total += strings.Count(header, "<span class=\"destination\">")
+	}
+	if total != len(schedule.KnownJourneys) {
+		t.Errorf("Pages show %d journeys, want %d", total, len(schedule.KnownJourneys))
+	}
+
+	renderer.SetPage(0)
+	if got := strings.Count(renderTestPartial(t, "timetable", renderer.timetableView(perPage)), "<table class=\"timetable\">"); got != pages {
+		t.Errorf("Rendering all pages gave %d tables, want %d", got, pages)
+	}
+}
+
+func TestFilterByDeparture(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/richmond_district_timetable.json")
+
+	renderer := newTestRenderer(t, timetable, 0)
+
+	after, _ := parseClockTime("07:00")
+	before, _ := parseClockTime("07:59")
+	renderer.SetFilter(JourneyFilter{After: after, Before: before})
+	selected := renderer.selectedJourneys()
+	if len(selected) == 0 {
+		t.Fatalf("No journeys selected between 07:00 and 07:59")
+	}
+	for _, j := range selected {
+		if j.Hour != "7" {
+			t.Errorf("Journey %s:%s is outside the window", j.Hour, j.Minute)
+		}
+	}
+}
+
+func TestParseClockTime(t *testing.T) {
+	if got, err := parseClockTime("00:30"); err != nil || got.Format(TimeFormat{ExtendedHours: true}) != "24:30" {
+		t.Errorf("parseClockTime(00:30) = %v, %v; want 24:30", got.Format(TimeFormat{ExtendedHours: true}), err)
+	}
+	for _, bad := range []string{"", "7", "aa:00", "07:75"} {
+		if _, err := parseClockTime(bad); err == nil {
+			t.Errorf("parseClockTime(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestFilterByArrivalAtStop(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/rickmansworth_metropolitan_timetable.json")
+
+	renderer := newTestRenderer(t, timetable, 0)
+
+	const watford = "940GZZLUWAF"
+	renderer.SetFilter(JourneyFilter{StopID: watford, Count: 1})
+	if got := len(renderer.selectedJourneys()); got != 1 {
+		t.Errorf("Selected %d journeys with count 1, want 1", got)
+	}
+
+	// Only two journeys run via the Watford branch, 05:32 and 06:08.
+	after, _ := parseClockTime("06:00")
+	renderer.SetFilter(JourneyFilter{After: after, StopID: watford})
+	selected := renderer.selectedJourneys()
+	if len(selected) != 1 {
+		t.Fatalf("Selected %d journeys, want 1", len(selected))
+	}
+	for _, j := range selected {
+		arrival, ok := renderer.arrivalAt(j, watford)
+		if !ok {
+			t.Errorf("Journey %s:%s doesn't call at Watford", j.Hour, j.Minute)
+		} else if arrival < after {
+			t.Errorf("Journey %s:%s reaches Watford at %s, before 06:00", j.Hour, j.Minute, arrival.Format(TimeFormat{}))
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"tfltt/tfl/models"
+)
+
+// minFoldRun is the shortest run of evenly spaced journeys that compact mode
+// folds into a "then every N minutes" column.
+const minFoldRun = 4
+
+// timetableColumn is a column of a rendered timetable: either a journey or,
+// in compact mode, a marker standing in for a run of regular journeys.
+type timetableColumn struct {
+	journey *models.TflAPIPresentationEntitiesKnownJourney
+	every   int // headway in minutes of a folded run; zero for journeys
+}
+
+// SetCompact enables folding runs of regular journeys into "then every N
+// minutes until" columns, the way printed TfL timetables do.
+func (tr *TimetableRenderer) SetCompact(compact bool) {
+	tr.compact = compact
+}
+
+// columns lays out journeys as timetable columns. In compact mode, runs of at
+// least minFoldRun journeys following the same stopping pattern at a constant
+// headway keep their first and last journeys and fold the rest.
+func (tr *TimetableRenderer) columns(journeys []*models.TflAPIPresentationEntitiesKnownJourney) []timetableColumn {
+	var cols []timetableColumn
+	for i := 0; i < len(journeys); {
+		end := i + 1
+		if tr.compact {
+			end = regularRunEnd(journeys, i)
+		}
+		if end-i < minFoldRun {
+			cols = append(cols, timetableColumn{journey: journeys[i]})
+			i++
+			continue
+		}
+		headway := journeyDeparture(journeys[i+1]) - journeyDeparture(journeys[i])
+		cols = append(cols,
+			timetableColumn{journey: journeys[i]},
+			timetableColumn{every: int(time.Duration(headway).Minutes())},
+			timetableColumn{journey: journeys[end-1]},
+		)
+		i = end
+	}
+	return cols
+}
+
+// regularRunEnd returns the end (exclusive) of the run of journeys starting at
+// start that share its interval and a constant whole-minute headway.
+func regularRunEnd(journeys []*models.TflAPIPresentationEntitiesKnownJourney, start int) int {
+	if start+1 >= len(journeys) || journeys[start+1].IntervalID != journeys[start].IntervalID {
+		return start + 1
+	}
+	headway := journeyDeparture(journeys[start+1]) - journeyDeparture(journeys[start])
+	if headway <= 0 {
+		return start + 1
+	}
+	end := start + 2
+	for end < len(journeys) &&
+		journeys[end].IntervalID == journeys[start].IntervalID &&
+		journeyDeparture(journeys[end])-journeyDeparture(journeys[end-1]) == headway {
+		end++
+	}
+	return end
+}
+
+// PeriodSummary describes the schedule's service periods, one line per
+// period, e.g. "07:00-07:59: every 8-11 minutes".
+func (tr *TimetableRenderer) PeriodSummary() []string {
+	var lines []string
+	for _, p := range tr.schedule.Periods {
+		if p.FromTime == nil || p.ToTime == nil {
+			continue
+		}
+		from := parseServiceTime(p.FromTime.Hour, p.FromTime.Minute).Format(tr.timeFormat)
+		to := parseServiceTime(p.ToTime.Hour, p.ToTime.Minute).Format(tr.timeFormat)
+		lines = append(lines, fmt.Sprintf("%s-%s: %s", from, to, describePeriod(p)))
+	}
+	return lines
+}
+
+func describePeriod(p *models.TflAPIPresentationEntitiesPeriod) string {
+	unit := ""
+	switch p.Type {
+	case "FrequencyMinutes":
+		unit = "minutes"
+	case "FrequencyHours":
+		unit = "hours"
+	default:
+		return "see timetable"
+	}
+	if p.Frequency == nil {
+		return "see timetable"
+	}
+	lo := math.Min(p.Frequency.HighestFrequency, p.Frequency.LowestFrequency)
+	hi := math.Max(p.Frequency.HighestFrequency, p.Frequency.LowestFrequency)
+	if lo == hi {
+		return fmt.Sprintf("every %g %s", lo, unit)
+	}
+	return fmt.Sprintf("every %g-%g %s", lo, hi, unit)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"tfltt/tfl/models"
+)
+
+func TestColumnsFoldRegularJourneys(t *testing.T) {
+	var journeys []*models.TflAPIPresentationEntitiesKnownJourney
+	for _, m := range []string{"00", "10", "20", "30", "40", "45"} {
+		journeys = append(journeys, &models.TflAPIPresentationEntitiesKnownJourney{Hour: "7", Minute: m})
+	}
+	tr := &TimetableRenderer{}
+
+	if got := len(tr.columns(journeys)); got != len(journeys) {
+		t.Errorf("non-compact columns = %d, want %d", got, len(journeys))
+	}
+
+	tr.SetCompact(true)
+	cols := tr.columns(journeys)
+	if len(cols) != 4 {
+		t.Fatalf("compact columns = %d, want 4", len(cols))
+	}
+	if cols[0].journey != journeys[0] || cols[1].every != 10 || cols[2].journey != journeys[4] || cols[3].journey != journeys[5] {
+		t.Errorf("unexpected compact columns: %+v", cols)
+	}
+}
+
+func TestPeriodSummary(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/richmond_district_timetable.json")
+	route := timetable.Timetable.Routes[0]
+
+	renderer := newTestRenderer(t, timetable, 0)
+	summary := renderer.PeriodSummary()
+	if len(summary) != len(route.Schedules[0].Periods) {
+		t.Fatalf("summary has %d lines, want %d", len(summary), len(route.Schedules[0].Periods))
+	}
+	if want := "07:00-07:59: every 8-11 minutes"; summary[2] != want {
+		t.Errorf("summary[2] = %q, want %q", summary[2], want)
+	}
+}
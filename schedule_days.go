@@ -0,0 +1,64 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// scheduleDayNames maps day names, as they appear in TfL schedule names, to
+// their time.Weekday.
+var scheduleDayNames = map[string]time.Weekday{
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+	"sunday":    time.Sunday,
+}
+
+var scheduleDayPattern = regexp.MustCompile(`(monday|tuesday|wednesday|thursday|friday|saturday|sunday)s?(\s*(?:-|–|to)\s*(monday|tuesday|wednesday|thursday|friday|saturday|sunday)s?)?`)
+
+// scheduleDays returns the days of the week a schedule runs on, indexed by
+// time.Weekday, derived from its name, e.g. "Monday - Friday", "Saturdays and
+// Public Holidays" or "Sunday". It reports false if the name names no days.
+func scheduleDays(name string) ([7]bool, bool) {
+	var days [7]bool
+	lower := strings.ToLower(name)
+	found := false
+
+	switch {
+	case strings.Contains(lower, "daily") || strings.Contains(lower, "every day"):
+		for d := range days {
+			days[d] = true
+		}
+		return days, true
+	case strings.Contains(lower, "weekday"):
+		for d := time.Monday; d <= time.Friday; d++ {
+			days[d] = true
+		}
+		found = true
+	}
+	if strings.Contains(lower, "weekend") {
+		days[time.Saturday], days[time.Sunday] = true, true
+		found = true
+	}
+
+	for _, m := range scheduleDayPattern.FindAllStringSubmatch(lower, -1) {
+		from := scheduleDayNames[m[1]]
+		to := from
+		if m[3] != "" {
+			to = scheduleDayNames[m[3]]
+		}
+		// Ranges run forwards through the week, wrapping past Sunday.
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+		found = true
+	}
+	return days, found
+}
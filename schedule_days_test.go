@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestScheduleDays(t *testing.T) {
+	testCases := []struct {
+		name string
+		want string // Sunday first, as time.Weekday
+		ok   bool
+	}{
+		{"Monday - Friday", "-MTWTF-", true},
+		{"Monday - Thursday", "-MTWT--", true},
+		{"Friday", "-----F-", true},
+		{"Saturdays and Public Holidays", "------S", true},
+		{"Sunday", "S------", true},
+		{"Friday - Sunday", "S----FS", true},
+		{"Weekdays", "-MTWTF-", true},
+		{"Daily", "SMTWTFS", true},
+		{"Special service", "-------", false},
+	}
+	for _, tc := range testCases {
+		days, ok := scheduleDays(tc.name)
+		got := []byte("-------")
+		for d, on := range days {
+			if on {
+				got[d] = "SMTWTFS"[d]
+			}
+		}
+		if string(got) != tc.want || ok != tc.ok {
+			t.Errorf("scheduleDays(%q) = %s, %v; want %s, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tfltt/tfl/models"
+)
+
+// serviceDayStartHour is the hour at which a service day begins. Departures
+// published with an earlier hour (e.g. "0" rather than "24") belong to the
+// previous day's service and run after midnight.
+const serviceDayStartHour = 4
+
+// ServiceTime is a time within a service day, measured from the midnight at
+// which the service day begins. Values of 24 hours or more are past midnight.
+type ServiceTime time.Duration
+
+// TimeFormat controls how a ServiceTime is rendered.
+type TimeFormat struct {
+	// ExtendedHours renders times past midnight as 24:xx, 25:xx, ... instead
+	// of wrapping them to 00:xx, 01:xx, ...
+	ExtendedHours bool
+	// Seconds keeps the seconds of fractional offsets instead of rounding to
+	// the nearest minute.
+	Seconds bool
+}
+
+// parseServiceTime converts the hour and minute strings used by TfL
+// timetables into a ServiceTime.
+func parseServiceTime(hour, minute string) ServiceTime {
+	h, _ := strconv.Atoi(hour)
+	m, _ := strconv.Atoi(minute)
+	if h < serviceDayStartHour {
+		h += 24
+	}
+	return ServiceTime(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute)
+}
+
+// journeyDeparture returns the departure time of a journey from the origin stop.
+func journeyDeparture(j *models.TflAPIPresentationEntitiesKnownJourney) ServiceTime {
+	return parseServiceTime(j.Hour, j.Minute)
+}
+
+// AddMinutes returns t offset by a possibly fractional number of minutes.
+func (t ServiceTime) AddMinutes(minutes float64) ServiceTime {
+	return t + ServiceTime(time.Duration(minutes*float64(time.Minute)).Round(time.Second))
+}
+
+func (t ServiceTime) Format(f TimeFormat) string {
+	d := time.Duration(t)
+	if !f.Seconds {
+		d = d.Round(time.Minute)
+	}
+	total := int(d / time.Second)
+	h, m, s := total/3600, total/60%60, total%60
+	if !f.ExtendedHours {
+		h %= 24
+	}
+	if f.Seconds {
+		return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", h, m)
+}
+
+// sortJourneys returns a copy of journeys ordered by departure time within
+// the service day.
+func sortJourneys(journeys []*models.TflAPIPresentationEntitiesKnownJourney) []*models.TflAPIPresentationEntitiesKnownJourney {
+	sorted := make([]*models.TflAPIPresentationEntitiesKnownJourney, len(journeys))
+	copy(sorted, journeys)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return journeyDeparture(sorted[a]) < journeyDeparture(sorted[b])
+	})
+	return sorted
+}
+
+// parseClockTime parses a "HH:MM" time of day into a ServiceTime. Hours
+// before serviceDayStartHour are taken as past midnight, and extended hours
+// such as "25:10" are accepted.
+func parseClockTime(s string) (ServiceTime, error) {
+	hour, minute, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q: want HH:MM", s)
+	}
+	h, err := strconv.Atoi(hour)
+	if err != nil || h < 0 || h > 47 {
+		return 0, fmt.Errorf("invalid hour in time %q", s)
+	}
+	m, err := strconv.Atoi(minute)
+	if err != nil || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid minute in time %q", s)
+	}
+	return parseServiceTime(hour, minute), nil
+}
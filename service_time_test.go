@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"tfltt/tfl/models"
+)
+
+func TestCalculateArrivalTime(t *testing.T) {
+	testCases := []struct {
+		name   string
+		hour   string
+		minute string
+		offset float64
+		format TimeFormat
+		want   string
+	}{
+		{"simple", "5", "22", 4, TimeFormat{}, "05:26"},
+		{"past midnight wraps", "23", "50", 20, TimeFormat{}, "00:10"},
+		{"past midnight extended", "23", "50", 20, TimeFormat{ExtendedHours: true}, "24:10"},
+		{"hour 24 extended", "24", "50", 61, TimeFormat{ExtendedHours: true}, "25:51"},
+		{"early hour is next day", "0", "40", 0, TimeFormat{ExtendedHours: true}, "24:40"},
+		{"fraction rounds", "5", "00", 2.5, TimeFormat{}, "05:03"},
+		{"fraction rounds down", "5", "00", 2.4, TimeFormat{}, "05:02"},
+		{"fraction keeps seconds", "5", "00", 2.5, TimeFormat{Seconds: true}, "05:02:30"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := calculateArrivalTime(tc.hour, tc.minute, tc.offset).Format(tc.format)
+			if got != tc.want {
+				t.Errorf("calculateArrivalTime(%q, %q, %v) = %q, want %q", tc.hour, tc.minute, tc.offset, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSortJourneysAfterMidnight(t *testing.T) {
+	journeys := []*models.TflAPIPresentationEntitiesKnownJourney{
+		{Hour: "0", Minute: "40"},
+		{Hour: "5", Minute: "30"},
+		{Hour: "23", Minute: "50"},
+	}
+	sorted := sortJourneys(journeys)
+	want := []string{"5:30", "23:50", "0:40"}
+	for i, j := range sorted {
+		if got := j.Hour + ":" + j.Minute; got != want[i] {
+			t.Errorf("sorted[%d] = %s, want %s", i, got, want[i])
+		}
+	}
+}
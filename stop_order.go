@@ -0,0 +1,152 @@
+package main
+
+import (
+	"slices"
+	"sort"
+)
+
+// stopGraph merges the stop sequences of a route's station intervals into a
+// directed graph whose edges join consecutive stops. Ordering the graph
+// topologically gives a stop order that respects every sequence, so that
+// skip-stop and branch services do not interleave their stops.
+type stopGraph struct {
+	seen  []string
+	index map[string]int
+	succ  map[string][]string
+}
+
+func newStopGraph() *stopGraph {
+	return &stopGraph{
+		index: make(map[string]int),
+		succ:  make(map[string][]string),
+	}
+}
+
+func (g *stopGraph) addStop(id string) {
+	if _, ok := g.index[id]; !ok {
+		g.index[id] = len(g.seen)
+		g.seen = append(g.seen, id)
+	}
+}
+
+// addSequence adds the stops of seq, in order, as a path through the graph.
+func (g *stopGraph) addSequence(seq []string) {
+	prev := ""
+	for _, id := range seq {
+		g.addStop(id)
+		if prev != "" && prev != id && !slices.Contains(g.succ[prev], id) {
+			g.succ[prev] = append(g.succ[prev], id)
+		}
+		prev = id
+	}
+}
+
+// reach returns the set of stops reachable from id, including id itself.
+func (g *stopGraph) reach(id string) map[string]bool {
+	seen := make(map[string]bool)
+	var visit func(string)
+	visit = func(u string) {
+		if seen[u] {
+			return
+		}
+		seen[u] = true
+		for _, v := range g.succ[u] {
+			visit(v)
+		}
+	}
+	visit(id)
+	return seen
+}
+
+// successors returns the successors of id with the one leading to the most
+// stops (the trunk) first, breaking ties by first-seen order.
+func (g *stopGraph) successors(id string) []string {
+	succ := append([]string(nil), g.succ[id]...)
+	size := make(map[string]int, len(succ))
+	for _, s := range succ {
+		size[s] = len(g.reach(s))
+	}
+	sort.SliceStable(succ, func(a, b int) bool {
+		if size[succ[a]] != size[succ[b]] {
+			return size[succ[a]] > size[succ[b]]
+		}
+		return g.index[succ[a]] < g.index[succ[b]]
+	})
+	return succ
+}
+
+// order returns every stop in the graph in topological order starting from
+// root. Stops on a branch are kept together and follow the trunk. Stops not
+// reachable from root are appended in first-seen order.
+func (g *stopGraph) order(root string) []string {
+	visited := make(map[string]bool)
+	var post []string
+	var visit func(string)
+	visit = func(u string) {
+		visited[u] = true
+		succ := g.successors(u)
+		// Reverse postorder lists the last visited successor first.
+		for i := len(succ) - 1; i >= 0; i-- {
+			if !visited[succ[i]] {
+				visit(succ[i])
+			}
+		}
+		post = append(post, u)
+	}
+
+	g.addStop(root)
+	visit(root)
+	ordered := make([]string, 0, len(g.seen))
+	for i := len(post) - 1; i >= 0; i-- {
+		ordered = append(ordered, post[i])
+	}
+	for _, id := range g.seen {
+		if !visited[id] {
+			ordered = append(ordered, id)
+		}
+	}
+	return ordered
+}
+
+// branches returns, for every stop on a branch, the first stop of that
+// branch. A branch starts where the line diverges into successors that never
+// meet again; the successor leading to the most stops is treated as the
+// continuing trunk. Nested branches are labelled by the innermost branch.
+func (g *stopGraph) branches(ordered []string) map[string]string {
+	branchOf := make(map[string]string)
+	for _, u := range ordered {
+		succ := g.successors(u)
+		if len(succ) < 2 {
+			continue
+		}
+		reaches := make([]map[string]bool, len(succ))
+		for i, s := range succ {
+			reaches[i] = g.reach(s)
+		}
+		for i := 1; i < len(succ); i++ {
+			disjoint := true
+			for j := range succ {
+				if j != i && overlaps(reaches[i], reaches[j]) {
+					disjoint = false
+					break
+				}
+			}
+			if !disjoint {
+				continue
+			}
+			for id := range reaches[i] {
+				branchOf[id] = succ[i]
+			}
+		}
+	}
+	return branchOf
+}
+
+func overlaps(a, b map[string]bool) bool {
+	for id := range a {
+		if b[id] {
+			return true
+		}
+	}
+	return false
+}
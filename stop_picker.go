@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"tfltt/tfl/client"
+	"tfltt/tfl/models"
+)
+
+// StopPickerCSS styles the stop picker page.
+const StopPickerCSS = `body { font-family: sans-serif; }
+nav.directions { margin-bottom: 1em; }
+table.stop-picker { border-collapse: collapse; }
+table.stop-picker th, table.stop-picker td { border-bottom: 1px solid #ddd; padding: 6px 8px; text-align: left; }
+`
+
+// pickerStop is a stop a passenger can board at, with the termini of the
+// routes continuing from it.
+type pickerStop struct {
+	id           string
+	name         string
+	destinations []string
+}
+
+// stopPickerStops lists the stops of a route sequence in line order, merging
+// its ordered routes as branches of a stop graph.
+func stopPickerStops(rs *models.TflAPIPresentationEntitiesRouteSequence) ([]pickerStop, map[string]string) {
+	names := make(map[string]string)
+	for _, s := range rs.Stations {
+		names[s.ID] = s.Name
+	}
+	for _, sps := range rs.StopPointSequences {
+		for _, sp := range sps.StopPoint {
+			if _, ok := names[sp.ID]; !ok {
+				names[sp.ID] = sp.Name
+			}
+		}
+	}
+
+	g := newStopGraph()
+	destinations := make(map[string][]string)
+	hasPredecessor := make(map[string]bool)
+	for _, r := range rs.OrderedLineRoutes {
+		if len(r.NaptanIds) == 0 {
+			continue
+		}
+		g.addSequence(r.NaptanIds)
+		terminus := r.NaptanIds[len(r.NaptanIds)-1]
+		for i, id := range r.NaptanIds {
+			if i > 0 {
+				hasPredecessor[id] = true
+			}
+			if id != terminus && !slices.Contains(destinations[id], terminus) {
+				destinations[id] = append(destinations[id], terminus)
+			}
+		}
+	}
+	if len(g.seen) == 0 {
+		return nil, names
+	}
+
+	root := g.seen[0]
+	for _, id := range g.seen {
+		if !hasPredecessor[id] {
+			root = id
+			break
+		}
+	}
+
+	var stops []pickerStop
+	for _, id := range g.order(root) {
+		name := names[id]
+		if name == "" {
+			name = id
+		}
+		stops = append(stops, pickerStop{id: id, name: name, destinations: destinations[id]})
+	}
+	return stops, names
+}
+
+// timetableURL returns the /timetable link for lineID from fromID to toID,
+// or from fromID in any direction if toID is empty.
+func timetableURL(lineID, fromID, toID string) string {
+	q := url.Values{"line": {lineID}, "from": {fromID}}
+	if toID != "" {
+		q.Set("to", toID)
+	}
+	return "/timetable?" + q.Encode()
+}
+
+// stopPickerRow is a stop with links to its timetable towards every
+// terminus served from it.
+type stopPickerRow struct {
+	Stop  string
+	Links []link
+}
+
+// stopPickerRows returns the rows of the "stop-picker" partial for stops,
+// linking to all departures from stops without a known terminus.
+func stopPickerRows(lineID string, stops []pickerStop, names map[string]string) []stopPickerRow {
+	var rows []stopPickerRow
+	for _, s := range stops {
+		row := stopPickerRow{Stop: shortStationName(s.name)}
+		for _, dest := range s.destinations {
+			name := names[dest]
+			if name == "" {
+				name = dest
+			}
+			row.Links = append(row.Links, link{Label: shortStationName(name), URL: timetableURL(lineID, s.id, dest)})
+		}
+		if len(row.Links) == 0 {
+			row.Links = append(row.Links, link{Label: "All departures", URL: timetableURL(lineID, s.id, "")})
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// stopPickerPage is the data of the stop picker page.
+type stopPickerPage struct {
+	layoutData
+	LineName   string
+	Directions []link
+	Stops      []stopPickerRow
+}
+
+// StopPickerHandler serves the stops of a line in one direction, linking
+// each to its timetable, so that passengers can board at any stop.
+func StopPickerHandler(tflClient *client.Tfl) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lineID := r.URL.Query().Get("line")
+		direction := strings.ToLower(r.URL.Query().Get("direction"))
+		if direction == "" {
+			direction = "outbound"
+		}
+
+		if lineID == "" {
+			http.Error(w, "Missing required parameter: line", http.StatusBadRequest)
+			return
+		}
+		if direction != "outbound" && direction != "inbound" {
+			http.Error(w, "direction must be outbound or inbound", http.StatusBadRequest)
+			return
+		}
+
+		routeSequence := fetchRouteSequence(tflClient, lineID, direction)
+		if routeSequence == nil {
+			http.Error(w, fmt.Sprintf("No stops found for %s", lineID), http.StatusNotFound)
+			return
+		}
+		stops, names := stopPickerStops(routeSequence)
+		lineName := routeSequence.LineName
+		if lineName == "" {
+			lineName = lineID
+		}
+
+		data := stopPickerPage{
+			layoutData: layoutData{Title: lineName + " stops", CSS: StopPickerCSS},
+			LineName:   lineName,
+			Stops:      stopPickerRows(lineID, stops, names),
+		}
+		for _, d := range []string{"outbound", "inbound"} {
+			data.Directions = append(data.Directions, link{
+				Label:   strings.ToUpper(d[:1]) + d[1:],
+				URL:     "/stops?" + url.Values{"line": {lineID}, "direction": {d}}.Encode(),
+				Current: d == direction,
+			})
+		}
+		renderPage(w, http.StatusOK, "stop_picker", data)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"tfltt/tfl/models"
+)
+
+func TestStopPickerStops(t *testing.T) {
+	rs := &models.TflAPIPresentationEntitiesRouteSequence{
+		Stations: []*models.TflAPIPresentationEntitiesMatchedStop{
+			{ID: "BKR", Name: "Baker Street Underground Station"},
+			{ID: "HOH", Name: "Harrow-on-the-Hill Underground Station"},
+			{ID: "RKY", Name: "Rickmansworth Underground Station"},
+			{ID: "AMS", Name: "Amersham Underground Station"},
+			{ID: "WAT", Name: "Watford Underground Station"},
+			{ID: "CHL", Name: "Chalfont & Latimer Underground Station"},
+		},
+		OrderedLineRoutes: []*models.TflAPIPresentationEntitiesOrderedRoute{
+			{NaptanIds: []string{"HOH", "WAT"}},
+			{NaptanIds: []string{"BKR", "HOH", "RKY", "CHL", "AMS"}},
+			{NaptanIds: []string{"BKR", "HOH", "WAT"}},
+		},
+	}
+
+	stops, names := stopPickerStops(rs)
+	var got []string
+	for _, s := range stops {
+		got = append(got, s.id+">"+strings.Join(s.destinations, ","))
+	}
+	want := []string{"BKR>AMS,WAT", "HOH>WAT,AMS", "RKY>AMS", "CHL>AMS", "AMS>", "WAT>"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Stops = %v, want %v", got, want)
+	}
+
+	output := renderTestPartial(t, "stop-picker", stopPickerRows("metropolitan", stops, names))
+	for _, want := range []string{
+		`<th scope="row">Chalfont &amp; Latimer</th><td><a href="/timetable?from=CHL&amp;line=metropolitan&amp;to=AMS">Amersham</a></td>`,
+		`<a href="/timetable?from=BKR&amp;line=metropolitan&amp;to=WAT">Watford</a>`,
+		`<th scope="row">Amersham</th><td><a href="/timetable?from=AMS&amp;line=metropolitan">All departures</a></td>`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Stop picker doesn't contain %q", want)
+		}
+	}
+}
+
+func TestTimetableFromPickedIntermediateStop(t *testing.T) {
+	// A route sequence for the whole line, from Amersham to Aldgate.
+	rs := metropolitanRouteSequence(t)
+
+	// The picker offers Rickmansworth, part way along the line.
+	stops, names := stopPickerStops(rs)
+	if !strings.Contains(renderTestPartial(t, "stop-picker", stopPickerRows("metropolitan", stops, names)), `href="/timetable?from=940GZZLURKW&amp;line=metropolitan&amp;to=940GZZLUALD"`) {
+		t.Fatalf("Stop picker doesn't link to the timetable from Rickmansworth")
+	}
+
+	// Its timetable starts at Rickmansworth and ends at Aldgate.
+	timetable := loadTestTimetable(t, "testdata/rickmansworth_metropolitan_timetable.json")
+	renderer := newTestRenderer(t, timetable, 0)
+	renderer.UseRouteSequence(rs)
+	renderer.SetPage(1)
+	output := renderTestPartial(t, "timetable", renderer.timetableView(journeysPerPage))
+
+	rows := regexp.MustCompile(`<th class="station" scope="row"[^>]*>([^<]*)</th>`).FindAllStringSubmatch(output, -1)
+	if len(rows) == 0 || rows[0][1] != "Rickmansworth Underground Station" {
+		t.Fatalf("Timetable rows = %v, want Rickmansworth first", rows)
+	}
+	for _, row := range rows {
+		for _, upstream := range []string{"Amersham", "Chalfont", "Chorleywood"} {
+			if strings.Contains(row[1], upstream) {
+				t.Errorf("Timetable has a row for %s, upstream of Rickmansworth", row[1])
+			}
+		}
+	}
+	if strings.Contains(output, "Terminates at Aldgate") {
+		t.Errorf("Trains to Aldgate carry a footnote")
+	}
+}
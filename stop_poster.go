@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"tfltt/tfl/client"
+)
+
+// StopPosterCSS styles stop posters for screen and for printing on A4 or A3.
+const StopPosterCSS = `body { font-family: sans-serif; margin: 1em; }
+.poster-header h1 { margin: 0; font-size: 1.8em; }
+.poster-header p { margin: 0.2em 0 1em; font-size: 1.1em; color: #444; }
+.poster-blocks { display: grid; grid-template-columns: repeat(auto-fit, minmax(14em, 1fr)); gap: 1em; align-items: start; }
+table.poster { border-collapse: collapse; width: 100%; }
+table.poster caption { background-color: #000; color: #fff; font-weight: bold; padding: 4px 6px; text-align: left; }
+table.poster th { width: 2.5em; text-align: right; padding: 2px 6px; border-right: 2px solid #000; font-variant-numeric: tabular-nums; }
+table.poster td { padding: 2px 6px; font-variant-numeric: tabular-nums; }
+table.poster tr:nth-child(even) { background-color: #f2f2f2; }
+table.poster .minute { display: inline-block; min-width: 2.2em; }
+table.poster sup, dl.notes dt { color: #9b0056; font-weight: bold; }
+dl.notes { display: grid; grid-template-columns: max-content auto; gap: 2px 8px; font-size: 0.9em; }
+dl.notes dd { margin: 0; }
+@page { size: A4 portrait; margin: 10mm; }
+@media print {
+  body { margin: 0; font-size: 10pt; }
+  .no-print { display: none; }
+  table.poster tr { break-inside: avoid; }
+  .poster-blocks { grid-template-columns: repeat(3, 1fr); }
+}
+`
+
+// stopPosterA3CSS overrides the page size for A3 posters.
+const stopPosterA3CSS = `@page { size: A3 portrait; margin: 12mm; }
+@media print { body { font-size: 13pt; } }
+`
+
+// stopPosterPage is the data of the stop poster page.
+type stopPosterPage struct {
+	layoutData
+	StopName    string
+	LineName    string
+	Destination string
+	Blocks      []posterBlock
+	Notes       []footnote
+}
+
+// posterBlock is one schedule's departures on the poster, or the error
+// rendering them.
+type posterBlock struct {
+	Schedule string
+	Hours    []posterHour
+	Error    string
+}
+
+// posterHour is the departures in one hour, by minute past the hour.
+type posterHour struct {
+	Hour       int
+	Departures []posterDeparture
+}
+
+// posterDeparture is a departure's minute past the hour, marked if its
+// destination has a footnote.
+type posterDeparture struct {
+	Minute int
+	Mark   string
+}
+
+// stopPosterBlock returns the departures of the schedule from stopID as a
+// poster block: one row per hour and the minutes past the hour across.
+// Journeys running to a destination in notes carry its mark; see
+// stopPosterNotes.
+func (tr *TimetableRenderer) stopPosterBlock(stopID string, notes map[string]destinationNote) posterBlock {
+	var hours []int
+	byHour := make(map[int][]posterDeparture)
+	for _, j := range tr.selectedJourneys() {
+		t, ok := tr.arrivalAt(j, stopID)
+		if !ok || tr.journeyDestination(j) == stopID {
+			continue
+		}
+		d := time.Duration(t).Round(time.Minute)
+		hour := int(d / time.Hour)
+		if _, ok := byHour[hour]; !ok {
+			hours = append(hours, hour)
+		}
+		byHour[hour] = append(byHour[hour], posterDeparture{
+			Minute: int(d % time.Hour / time.Minute),
+			Mark:   notes[tr.journeyDestination(j)].mark,
+		})
+	}
+
+	block := posterBlock{Schedule: tr.schedule.Name}
+	for _, hour := range hours {
+		h := hour
+		if !tr.timeFormat.ExtendedHours {
+			h %= 24
+		}
+		block.Hours = append(block.Hours, posterHour{Hour: h, Departures: byHour[hour]})
+	}
+	return block
+}
+
+// stopPosterNotes assigns footnote marks to the destinations, other than
+// the principal one, of journeys calling at stopID in any of renderers, so
+// that a mark means the same destination in every block of the poster.
+// It also returns the notes in mark order for the legend.
+func stopPosterNotes(renderers []*TimetableRenderer, stopID string) (map[string]destinationNote, []destinationNote) {
+	notes := make(map[string]destinationNote)
+	var legend []destinationNote
+	for _, tr := range renderers {
+		principal := tr.principalDestination()
+		for _, j := range tr.selectedJourneys() {
+			dest := tr.journeyDestination(j)
+			if dest == "" || dest == principal || dest == stopID {
+				continue
+			}
+			if _, ok := tr.arrivalAt(j, stopID); !ok {
+				continue
+			}
+			if _, ok := notes[dest]; !ok {
+				note := destinationNote{mark: noteMark(len(notes)), stopID: dest, name: tr.stationNames[dest]}
+				notes[dest] = note
+				legend = append(legend, note)
+			}
+		}
+	}
+	return notes, legend
+}
+
+// StopPosterHandler serves a printable departures poster for one stop of a
+// route, with a block per schedule. paper=A3 lays it out for A3.
+func StopPosterHandler(tflClient *client.Tfl) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lineID := r.URL.Query().Get("line")
+		fromID := r.URL.Query().Get("from")
+		toID := r.URL.Query().Get("to")
+		stopID := r.URL.Query().Get("stop")
+		if stopID == "" {
+			stopID = fromID
+		}
+
+		if lineID == "" || fromID == "" {
+			http.Error(w, "Missing required parameters: line, from", http.StatusBadRequest)
+			return
+		}
+
+		payload, problem := loadTimetable(tflClient, lineID, fromID, toID)
+		if problem != nil {
+			problem.writePage(w)
+			return
+		}
+
+		routeSequence := fetchRouteSequence(tflClient, lineID, payload.Direction)
+
+		var blocks []posterBlock
+		var renderers []*TimetableRenderer
+		stopName, destName := stopID, toID
+		for _, route := range payload.Timetable.Routes {
+			for _, schedule := range route.Schedules {
+				renderer, err := NewTimetableRenderer(payload, route, schedule)
+				if err != nil {
+					blocks = append(blocks, posterBlock{Error: fmt.Sprintf("Error rendering schedule %s: %v", schedule.Name, err)})
+					continue
+				}
+				renderer.UseRouteSequence(routeSequence)
+				if name, ok := renderer.stationNames[stopID]; ok {
+					stopName = shortStationName(name)
+				}
+				if name, ok := renderer.stationNames[renderer.principalDestination()]; ok {
+					destName = shortStationName(name)
+				}
+				renderers = append(renderers, renderer)
+			}
+		}
+
+		notes, legend := stopPosterNotes(renderers, stopID)
+		for _, renderer := range renderers {
+			blocks = append(blocks, renderer.stopPosterBlock(stopID, notes))
+		}
+
+		css := StopPosterCSS
+		if strings.EqualFold(r.URL.Query().Get("paper"), "A3") {
+			css += stopPosterA3CSS
+		}
+		data := stopPosterPage{
+			layoutData:  layoutData{Title: stopName + " departures", CSS: template.CSS(css)},
+			StopName:    stopName,
+			LineName:    payload.LineName,
+			Destination: destName,
+			Blocks:      blocks,
+		}
+		for _, n := range legend {
+			data.Notes = append(data.Notes, footnote{Mark: n.mark, Destination: shortStationName(n.name)})
+		}
+		renderPage(w, http.StatusOK, "stop_poster", data)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStopPosterBlock(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/rickmansworth_metropolitan_timetable.json")
+	route := timetable.Timetable.Routes[0]
+
+	renderer := newTestRenderer(t, timetable, 0)
+	notes := renderer.destinationNotes()
+	watford := notes[renderer.journeyDestination(renderer.journeys[0])]
+	output := renderTestPartial(t, "poster-block", renderer.stopPosterBlock(timetable.Timetable.DepartureStopID, notes))
+
+	if !strings.Contains(output, "<caption>"+route.Schedules[0].Name+"</caption>") {
+		t.Errorf("Poster doesn't name the schedule %q", route.Schedules[0].Name)
+	}
+
+	// Each hour appears once, in service day order.
+	hours := regexp.MustCompile(`<th scope="row">(\d\d)</th>`).FindAllStringSubmatch(output, -1)
+	if len(hours) == 0 || hours[0][1] != "05" {
+		t.Fatalf("Poster hours = %v, want the first to be 05", hours)
+	}
+	seen := make(map[string]bool)
+	for _, h := range hours {
+		if seen[h[1]] {
+			t.Errorf("Hour %s appears more than once", h[1])
+		}
+		seen[h[1]] = true
+	}
+
+	if got, want := strings.Count(output, `class="minute"`), len(renderer.journeys); got != want {
+		t.Errorf("Got %d departures, want %d", got, want)
+	}
+	if want := `<span class="minute">32<sup>` + watford.mark + `</sup></span>`; watford.mark == "" || !strings.Contains(output, want) {
+		t.Errorf("Poster doesn't mark the 05:32 to Watford with %q", want)
+	}
+}
+
+func TestStopPosterBlockUnknownStop(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/rickmansworth_metropolitan_timetable.json")
+
+	renderer := newTestRenderer(t, timetable, 0)
+	output := renderTestPartial(t, "poster-block", renderer.stopPosterBlock("940GZZNOWHERE", renderer.destinationNotes()))
+	if !strings.Contains(output, "No departures") {
+		t.Errorf("Poster for an unserved stop should say there are no departures")
+	}
+}
+
+func TestStopPosterNotes(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/rickmansworth_metropolitan_timetable.json")
+
+	// On Sundays a train runs short to Harrow-on-the-Hill; on Saturdays one
+	// runs to Watford instead.
+	var renderers []*TimetableRenderer
+	for _, i := range []int{2, 3} {
+		renderer := newTestRenderer(t, timetable, i)
+		renderers = append(renderers, renderer)
+	}
+
+	notes, legend := stopPosterNotes(renderers, "940GZZLURKW")
+	harrow, watford := notes["940GZZLUHOH"], notes["940GZZLUWAF"]
+	if harrow.mark == "" || watford.mark == "" || harrow.mark == watford.mark {
+		t.Errorf("Harrow mark %q and Watford mark %q, want two different marks", harrow.mark, watford.mark)
+	}
+	if len(legend) != len(notes) {
+		t.Errorf("Legend has %d notes, want %d", len(legend), len(notes))
+	}
+	for i := 1; i < len(legend); i++ {
+		if legend[i-1].mark >= legend[i].mark {
+			t.Errorf("Legend not in mark order: %+v", legend)
+		}
+	}
+	if _, ok := notes["940GZZLUALD"]; ok {
+		t.Errorf("Trains to the principal destination carry a note")
+	}
+
+	// Watford trains don't call at Harrow-on-the-Hill, and trains ending
+	// there need no note on its own poster.
+	notes, _ = stopPosterNotes(renderers, "940GZZLUHOH")
+	for _, id := range []string{"940GZZLUWAF", "940GZZLUHOH"} {
+		if _, ok := notes[id]; ok {
+			t.Errorf("Harrow-on-the-Hill poster has a note for %s", id)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// Layout of the string-line diagram, in SVG user units.
+const (
+	svgStationColWidth = 220
+	svgMarginTop       = 40
+	svgMarginRight     = 20
+	svgMarginBottom    = 20
+	svgRowHeight       = 18
+	svgPixelsPerMinute = 4
+)
+
+// RenderAsSvg renders the selected journeys as a self-contained SVG
+// time-distance (string-line) diagram: stops down the Y axis in route order,
+// time across the X axis and one line per journey. The time axis spans the
+// filter's After and Before bounds, widened to the journeys' times.
+func (tr *TimetableRenderer) RenderAsSvg() string {
+	journeys := tr.selectedJourneys()
+
+	// Time axis, widened to whole hours. Journeys are drawn to their last
+	// stop, so the axis covers every plotted time as well as the filter's
+	// bounds.
+	start, end := tr.filter.After, tr.filter.Before
+	for _, j := range journeys {
+		for _, s := range tr.stops {
+			t, ok := tr.arrivalAt(j, s.id)
+			if !ok {
+				continue
+			}
+			if start == 0 || t < start {
+				start = t
+			}
+			if t > end {
+				end = t
+			}
+		}
+	}
+	start = ServiceTime(time.Duration(start).Truncate(time.Hour))
+	end = ServiceTime((time.Duration(end) + time.Hour - 1).Truncate(time.Hour))
+	if end <= start {
+		end = start + ServiceTime(time.Hour)
+	}
+
+	plotWidth := time.Duration(end-start).Minutes() * svgPixelsPerMinute
+	width := svgStationColWidth + plotWidth + svgMarginRight
+	height := svgMarginTop + len(tr.stops)*svgRowHeight + svgMarginBottom
+	x := func(t ServiceTime) float64 {
+		return svgStationColWidth + time.Duration(t-start).Minutes()*svgPixelsPerMinute
+	}
+	y := func(row int) int {
+		return svgMarginTop + row*svgRowHeight + svgRowHeight/2
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%d" viewBox="0 0 %.0f %d" font-family="sans-serif" font-size="11">`, width, height, width, height)
+	fmt.Fprintf(&sb, `<title>%s</title>`, html.EscapeString(fmt.Sprintf("%s: %s", tr.timetable.LineName, tr.schedule.Name)))
+	sb.WriteString(`<rect width="100%" height="100%" fill="#fff"/>`)
+
+	// Stops
+	for i, s := range tr.stops {
+		fmt.Fprintf(&sb, `<line x1="%d" y1="%d" x2="%.1f" y2="%d" stroke="#ddd"/>`, svgStationColWidth, y(i), width-svgMarginRight, y(i))
+		name := shortStationName(s.name)
+		if s.branch != "" {
+			name = "│ " + name
+		}
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" dominant-baseline="middle" text-anchor="end">%s</text>`, svgStationColWidth-6, y(i), html.EscapeString(name))
+	}
+
+	// Hours
+	for t := start; t <= end; t += ServiceTime(time.Hour) {
+		fmt.Fprintf(&sb, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#bbb" stroke-dasharray="2,3"/>`, x(t), svgMarginTop-6, x(t), height-svgMarginBottom)
+		fmt.Fprintf(&sb, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, x(t), svgMarginTop-12, t.Format(tr.timeFormat))
+	}
+
+	// Journeys
+	principal := tr.principalDestination()
+	for _, j := range journeys {
+		var points []string
+		for i, s := range tr.stops {
+			if t, ok := tr.arrivalAt(j, s.id); ok {
+				points = append(points, fmt.Sprintf("%.1f,%d", x(t), y(i)))
+			}
+		}
+		if len(points) == 0 {
+			continue
+		}
+		dest := tr.journeyDestination(j)
+		stroke := "#9b0056"
+		if dest != principal {
+			stroke = "#e07b00"
+		}
+		label := fmt.Sprintf("%s to %s", journeyDeparture(j).Format(tr.timeFormat), shortStationName(tr.stationNames[dest]))
+		fmt.Fprintf(&sb, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"><title>%s</title></polyline>`, strings.Join(points, " "), stroke, html.EscapeString(label))
+	}
+
+	sb.WriteString("</svg>")
+	return sb.String()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRenderAsSvg(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/rickmansworth_metropolitan_timetable.json")
+
+	renderer := newTestRenderer(t, timetable, 0)
+	after, _ := parseClockTime("05:00")
+	before, _ := parseClockTime("06:59")
+	renderer.SetFilter(JourneyFilter{After: after, Before: before})
+
+	output := renderer.RenderAsSvg()
+
+	// The output must be well-formed XML to display as a standalone image.
+	d := xml.NewDecoder(strings.NewReader(output))
+	for {
+		if _, err := d.Token(); err != nil {
+			if err != io.EOF {
+				t.Fatalf("SVG is not well-formed: %v", err)
+			}
+			break
+		}
+	}
+
+	if got, want := strings.Count(output, "<polyline"), len(renderer.selectedJourneys()); got != want {
+		t.Errorf("Got %d journey lines, want %d", got, want)
+	}
+	// Journeys departing before 06:59 run past it, and must stay inside the
+	// image.
+	var svg struct {
+		Width     float64 `xml:"width,attr"`
+		Polylines []struct {
+			Points string `xml:"points,attr"`
+		} `xml:"polyline"`
+	}
+	if err := xml.Unmarshal([]byte(output), &svg); err != nil {
+		t.Fatalf("Failed to parse SVG: %v", err)
+	}
+	for _, p := range svg.Polylines {
+		for _, point := range strings.Fields(p.Points) {
+			xs, _, _ := strings.Cut(point, ",")
+			if x, err := strconv.ParseFloat(xs, 64); err != nil || x > svg.Width {
+				t.Fatalf("Journey point %s lies outside the %.0f wide image", point, svg.Width)
+			}
+		}
+	}
+
+	for _, want := range []string{">05:00</text>", ">07:00</text>", ">08:00</text>", "<title>05:32 to Watford</title>", ">│ Watford</text>"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("SVG doesn't contain %q", want)
+		}
+	}
+}
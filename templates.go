@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+//go:embed templates/*.html templates/partials/*.html
+var templateFS embed.FS
+
+// pageTemplates holds every page template, keyed by its file name without
+// extension, each parsed together with the shared layout and partials.
+var pageTemplates = parsePageTemplates(templateFS)
+
+// partialTemplates holds the partials on their own, for fragments rendered
+// outside a page such as the board pushed by /board/stream.
+var partialTemplates = template.Must(template.ParseFS(templateFS, "templates/partials/*.html"))
+
+// layoutData is embedded in the data of every page for the shared layout.
+type layoutData struct {
+	Title string
+	// CSS is the page's stylesheet. It must be a trusted constant.
+	CSS template.CSS
+}
+
+// link is a labelled URL. Current marks the link to the page being shown.
+type link struct {
+	Label   string
+	URL     string
+	Current bool
+}
+
+func parsePageTemplates(fsys fs.FS) map[string]*template.Template {
+	files, err := fs.Glob(fsys, "templates/*.html")
+	if err != nil {
+		panic(err)
+	}
+	pages := make(map[string]*template.Template)
+	for _, f := range files {
+		name := strings.TrimSuffix(path.Base(f), ".html")
+		if name == "layout" {
+			continue
+		}
+		pages[name] = template.Must(template.New(name).ParseFS(fsys, "templates/layout.html", "templates/partials/*.html", f))
+	}
+	return pages
+}
+
+// renderPage writes the named page with status. The page is rendered in
+// full before anything is written, so a template error is reported as a 500
+// rather than a truncated page.
+func renderPage(w http.ResponseWriter, status int, name string, data any) {
+	var buf bytes.Buffer
+	if err := pageTemplates[name].ExecuteTemplate(&buf, "layout", data); err != nil {
+		log.Printf("Error rendering %s page: %v", name, err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// renderPartial returns the named partial rendered with data.
+func renderPartial(name string, data any) (string, error) {
+	var sb strings.Builder
+	if err := partialTemplates.ExecuteTemplate(&sb, name, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPageTemplatesEscapeDynamicValues(t *testing.T) {
+	const attack = `"><script>alert(1)</script>`
+	notice := disruptionNotice{Title: attack, Paragraphs: []string{attack}, AffectedStops: attack}
+	badges := statusBadges{Badges: []statusBadge{{Class: attack, Text: attack}}, URL: "javascript:alert(1)"}
+	timetable := timetableView{
+		Periods: []string{attack},
+		Tables: []timetableTable{{
+			Columns:   []timetableColumnHeading{{Departs: attack, Destination: attack, Mark: attack, Live: &liveBadge{Class: attack, Text: attack}}},
+			RowGroups: []timetableRowGroup{{Branch: attack, Rows: []timetableRow{{Station: attack, Cells: []timetableCell{{Class: attack, Title: attack, Text: attack}}}}}},
+		}},
+		Notes:     []footnote{{Mark: attack, Destination: attack}},
+		FirstLast: []firstLastRow{{Station: attack, First: attack, Last: attack, Calls: true}},
+	}
+	comparison := comparisonTable{
+		Schedules: []string{attack},
+		Periods:   []comparisonPeriod{{Name: attack, Hours: attack}},
+		Rows:      []comparisonRow{{Station: attack, Cells: []comparisonCell{{Calls: true, First: attack, Last: attack}}}},
+	}
+	pages := map[string]any{
+		"timetable": timetablePage{
+			LineID: attack, FromID: attack, ToID: attack,
+			Disruptions: []disruptionNotice{notice},
+			ViewSwitch:  link{Label: attack, URL: "/timetable?line=" + attack},
+			Sections: []timetableSection{
+				{Heading: attack, Timetable: &timetable},
+				{Heading: attack, Comparison: &comparison},
+				{Error: attack},
+			},
+		},
+		"index": indexPage{
+			ModeName: attack,
+			Modes:    []link{{Label: attack, URL: "javascript:alert(1)"}},
+			Lines:    []indexLine{{Name: attack, Status: &badges, Routes: []indexRoutes{{Outbound: &link{Label: attack, URL: attack}}}}},
+		},
+		"problem": problemPage{Message: attack, Options: []link{{Label: attack}}},
+		"stop_poster": stopPosterPage{
+			StopName: attack, LineName: attack,
+			Blocks: []posterBlock{{Schedule: attack, Hours: []posterHour{{Hour: 5, Departures: []posterDeparture{{Minute: 1, Mark: attack}}}}}},
+			Notes:  []footnote{{Mark: attack, Destination: attack}},
+		},
+		"board": boardPage{
+			StationName: attack, StreamURL: "/board/stream?stop=" + attack, RefreshSeconds: 30,
+			Board: []boardPlatform{{Name: attack, Arrivals: []boardArrival{{Order: 1, Destination: attack, Location: attack, Due: attack}}}},
+		},
+		"line_status": lineStatusPage{
+			Modes: attack,
+			Board: lineStatusBoard{
+				Lines:       []lineStatusRow{{Name: attack, Badges: badges, Reasons: []string{attack}, Anchor: attack}},
+				Disruptions: []lineDisruptions{{Anchor: attack, Name: attack, Notices: []disruptionNotice{notice}}},
+			},
+		},
+		"stop_picker": stopPickerPage{
+			LineName:   attack,
+			Directions: []link{{Label: attack}},
+			Stops:      []stopPickerRow{{Stop: attack, Links: []link{{Label: attack, URL: "javascript:alert(1)"}}}},
+		},
+	}
+	for name := range pageTemplates {
+		if _, ok := pages[name]; !ok {
+			t.Errorf("No escaping test for page %q", name)
+		}
+	}
+
+	for name, data := range pages {
+		rec := httptest.NewRecorder()
+		renderPage(rec, http.StatusOK, name, data)
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d: %s", name, rec.Code, body)
+			continue
+		}
+		if strings.Contains(body, "<script>alert") {
+			t.Errorf("%s: page contains unescaped input: %s", name, body)
+		}
+		if strings.Contains(body, "javascript:") {
+			t.Errorf("%s: page contains an unsafe URL: %s", name, body)
+		}
+	}
+}
+
+func TestRenderPageLayout(t *testing.T) {
+	rec := httptest.NewRecorder()
+	renderPage(rec, http.StatusNotFound, "board", boardPage{
+		layoutData:     layoutData{Title: "Baker Street", CSS: template.CSS(BoardCSS)},
+		StationName:    "Baker Street",
+		RefreshSeconds: 30,
+	})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"<title>Baker Street</title>",
+		`<noscript><meta http-equiv="refresh" content="30"></noscript>`,
+		"<style>body { background-color: #111;",
+		"location.reload(),  30  * 1000",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Board page doesn't contain %q:\n%s", want, body)
+		}
+	}
+}
+
+// renderTestPartial returns the named partial rendered with data.
+func renderTestPartial(t *testing.T, name string, data any) string {
+	t.Helper()
+	out, err := renderPartial(name, data)
+	if err != nil {
+		t.Fatalf("Rendering %s: %v", name, err)
+	}
+	return out
+}
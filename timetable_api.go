@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tfltt/tfl/client"
+	"tfltt/tfl/models"
+)
+
+// TimetableDocument is the normalized timetable served by /api/v1/timetable.
+// Times are "HH:MM" within the service day, running past 24:00 after
+// midnight so that they sort correctly.
+type TimetableDocument struct {
+	LineID          string             `json:"lineId"`
+	LineName        string             `json:"lineName"`
+	Direction       string             `json:"direction,omitempty"`
+	DepartureStopID string             `json:"departureStopId"`
+	Schedules       []ScheduleDocument `json:"schedules"`
+}
+
+type ScheduleDocument struct {
+	Name      string              `json:"name"`
+	Stops     []StopDocument      `json:"stops"`
+	Journeys  []JourneyDocument   `json:"journeys"`
+	FirstLast []FirstLastDocument `json:"firstLast"`
+}
+
+type StopDocument struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	IsStation bool   `json:"isStation"`
+	Branch    string `json:"branch,omitempty"`
+}
+
+type JourneyDocument struct {
+	Departure   string         `json:"departure"`
+	Destination string         `json:"destination"`
+	Calls       []CallDocument `json:"calls"`
+}
+
+type CallDocument struct {
+	StopID string `json:"stopId"`
+	Time   string `json:"time"`
+}
+
+type FirstLastDocument struct {
+	StopID string `json:"stopId"`
+	First  string `json:"first,omitempty"`
+	Last   string `json:"last,omitempty"`
+}
+
+// Document returns the schedule in normalized form, with every journey
+// selected by the filter expanded into its calls.
+func (tr *TimetableRenderer) Document() ScheduleDocument {
+	isStop := make(map[string]bool)
+	for _, s := range tr.timetable.Stops {
+		isStop[s.ID] = true
+	}
+
+	doc := ScheduleDocument{
+		Name:      tr.schedule.Name,
+		Stops:     []StopDocument{},
+		Journeys:  []JourneyDocument{},
+		FirstLast: []FirstLastDocument{},
+	}
+	for _, s := range tr.stops {
+		doc.Stops = append(doc.Stops, StopDocument{
+			ID:        s.id,
+			Name:      strings.TrimSuffix(s.name, " [S]"),
+			IsStation: !isStop[s.id],
+			Branch:    s.branch,
+		})
+	}
+	for _, j := range tr.selectedJourneys() {
+		jd := JourneyDocument{
+			Departure:   journeyDeparture(j).Format(tr.timeFormat),
+			Destination: tr.journeyDestination(j),
+			Calls:       []CallDocument{},
+		}
+		for _, s := range tr.stops {
+			if t, ok := tr.arrivalAt(j, s.id); ok {
+				jd.Calls = append(jd.Calls, CallDocument{StopID: s.id, Time: t.Format(tr.timeFormat)})
+			}
+		}
+		doc.Journeys = append(doc.Journeys, jd)
+	}
+	for _, fl := range tr.firstLastTrains() {
+		fld := FirstLastDocument{StopID: fl.stop.id}
+		if fl.calls {
+			fld.First = fl.first.Format(tr.timeFormat)
+			fld.Last = fl.last.Format(tr.timeFormat)
+		}
+		doc.FirstLast = append(doc.FirstLast, fld)
+	}
+	return doc
+}
+
+// writeJSON writes v as the JSON response body with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing JSON response: %v", err)
+	}
+}
+
+type apiError struct {
+	Error   string                                                             `json:"error"`
+	Options []*models.TflAPIPresentationEntitiesTimetablesDisambiguationOption `json:"options,omitempty"`
+}
+
+func TimetableAPIHandler(tflClient *client.Tfl) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lineID := r.URL.Query().Get("line")
+		fromID := r.URL.Query().Get("from")
+		toID := r.URL.Query().Get("to")
+
+		if lineID == "" || fromID == "" {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "Missing required parameters: line, from"})
+			return
+		}
+
+		filter, err := journeyFilterFromQuery(r.URL.Query())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		seconds, _ := strconv.ParseBool(r.URL.Query().Get("seconds"))
+		timeFormat := TimeFormat{ExtendedHours: true, Seconds: seconds}
+
+		payload, problem := loadTimetable(tflClient, lineID, fromID, toID)
+		if problem != nil {
+			writeJSON(w, problem.Status, apiError{Error: problem.Message, Options: problem.Options})
+			return
+		}
+
+		routeSequence := fetchRouteSequence(tflClient, lineID, payload.Direction)
+
+		doc := TimetableDocument{
+			LineID:          payload.LineID,
+			LineName:        payload.LineName,
+			Direction:       payload.Direction,
+			DepartureStopID: payload.Timetable.DepartureStopID,
+			Schedules:       []ScheduleDocument{},
+		}
+		for _, route := range payload.Timetable.Routes {
+			for _, schedule := range route.Schedules {
+				renderer, err := NewTimetableRenderer(payload, route, schedule)
+				if err != nil {
+					writeJSON(w, http.StatusInternalServerError, apiError{Error: fmt.Sprintf("Error rendering schedule %s: %v", schedule.Name, err)})
+					return
+				}
+				renderer.UseRouteSequence(routeSequence)
+				renderer.SetTimeFormat(timeFormat)
+				renderer.SetFilter(filter)
+				doc.Schedules = append(doc.Schedules, renderer.Document())
+			}
+		}
+		writeJSON(w, http.StatusOK, doc)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestScheduleDocument(t *testing.T) {
+	timetable := loadTestTimetable(t, "testdata/rickmansworth_metropolitan_timetable.json")
+	route := timetable.Timetable.Routes[0]
+	schedule := route.Schedules[0]
+
+	renderer := newTestRenderer(t, timetable, 0)
+	renderer.SetTimeFormat(TimeFormat{ExtendedHours: true})
+	doc := renderer.Document()
+
+	if len(doc.Stops) != len(renderer.stops) || len(doc.Journeys) != len(schedule.KnownJourneys) {
+		t.Fatalf("Document has %d stops and %d journeys, want %d and %d", len(doc.Stops), len(doc.Journeys), len(renderer.stops), len(schedule.KnownJourneys))
+	}
+	if doc.Stops[0].ID != "940GZZLURKW" || doc.Stops[0].Name != "Rickmansworth Underground Station" {
+		t.Errorf("First stop = %+v", doc.Stops[0])
+	}
+
+	first := doc.Journeys[0]
+	if first.Departure != "05:32" || first.Destination != "940GZZLUWAF" {
+		t.Errorf("First journey = %s to %s, want 05:32 to 940GZZLUWAF", first.Departure, first.Destination)
+	}
+	want := []CallDocument{{"940GZZLURKW", "05:32"}, {"940GZZLUCXY", "05:36"}, {"940GZZLUWAF", "05:40"}}
+	if len(first.Calls) != len(want) {
+		t.Fatalf("First journey calls = %v, want %v", first.Calls, want)
+	}
+	for i := range want {
+		if first.Calls[i] != want[i] {
+			t.Errorf("Call %d = %v, want %v", i, first.Calls[i], want[i])
+		}
+	}
+
+	last := doc.Journeys[len(doc.Journeys)-1]
+	if last.Departure < "24:00" {
+		t.Errorf("Last journey departs %s, want extended hours past midnight", last.Departure)
+	}
+
+	if _, err := json.Marshal(doc); err != nil {
+		t.Errorf("Failed to marshal document: %v", err)
+	}
+}
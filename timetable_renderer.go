@@ -2,14 +2,17 @@ package main
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
 	"tfltt/tfl/models"
 )
 
 type stopInfo struct {
-	id   string
-	name string
+	id     string
+	name   string
+	branch string // label of the branch the stop is on; empty on the trunk
 }
 
 type TimetableRenderer struct {
@@ -18,7 +21,15 @@ type TimetableRenderer struct {
 	schedule     *models.TflAPIPresentationEntitiesSchedule
 	stationNames map[string]string
 	stops        []stopInfo
+	stopGraph    *stopGraph
 	intervalData map[int32]map[string]float64
+	journeys     []*models.TflAPIPresentationEntitiesKnownJourney
+	timeFormat   TimeFormat
+	compact      bool
+	filter       JourneyFilter
+	page         int
+	live         map[*models.TflAPIPresentationEntitiesKnownJourney]liveStatus
+	disrupted    map[string]bool
 }
 
 func NewTimetableRenderer(timetableResponse *models.TflAPIPresentationEntitiesTimetableResponse, targetRoute *models.TflAPIPresentationEntitiesTimetableRoute, schedule *models.TflAPIPresentationEntitiesSchedule) (*TimetableRenderer, error) {
@@ -37,15 +48,13 @@ func NewTimetableRenderer(timetableResponse *models.TflAPIPresentationEntitiesTi
 		}
 	}
 
-	var stops []stopInfo
-	addedStops := make(map[string]bool)
+	graph := newStopGraph()
 	intervalData := make(map[int32]map[string]float64)
 
 	depID := timetableResponse.Timetable.DepartureStopID
-	stops = append(stops, stopInfo{id: depID, name: stationNames[depID]})
-	addedStops[depID] = true
+	graph.addStop(depID)
 
-	// Build interval map and collect all unique stops in order
+	// Build interval map and merge the stop sequence of every interval
 	for _, si := range targetRoute.StationIntervals {
 		id64, _ := strconv.ParseInt(si.ID, 10, 32)
 		idInt := int32(id64)
@@ -53,96 +62,392 @@ func NewTimetableRenderer(timetableResponse *models.TflAPIPresentationEntitiesTi
 		m := make(map[string]float64)
 		m[depID] = 0
 
+		seq := []string{depID}
 		for _, intv := range si.Intervals {
 			m[intv.StopID] = intv.TimeToArrival
-			if !addedStops[intv.StopID] {
-				addedStops[intv.StopID] = true
-				stops = append(stops, stopInfo{id: intv.StopID, name: stationNames[intv.StopID]})
-			}
+			seq = append(seq, intv.StopID)
 		}
+		graph.addSequence(seq)
 		intervalData[idInt] = m
 	}
 
-	return &TimetableRenderer{
+	tr := &TimetableRenderer{
 		timetable:    timetableResponse,
 		targetRoute:  targetRoute,
 		schedule:     schedule,
 		stationNames: stationNames,
-		stops:        stops,
+		stopGraph:    graph,
 		intervalData: intervalData,
-	}, nil
+		journeys:     sortJourneys(schedule.KnownJourneys),
+	}
+	tr.orderStops()
+	return tr, nil
+}
+
+// UseRouteSequence refines the stop order with the stop point sequences of
+// the line's route sequence, chaining branches through NextBranchIds. Only
+// sequences running in the timetable's direction are used, and only the
+// stops this route's intervals serve: the route sequence covers the whole
+// line, including stops upstream of the departure stop.
+func (tr *TimetableRenderer) UseRouteSequence(rs *models.TflAPIPresentationEntitiesRouteSequence) {
+	if rs == nil {
+		return
+	}
+	byBranch := make(map[int32]*models.TflAPIPresentationEntitiesStopPointSequence)
+	for _, sps := range rs.StopPointSequences {
+		if tr.timetable.Direction != "" && !strings.EqualFold(sps.Direction, tr.timetable.Direction) {
+			continue
+		}
+		byBranch[sps.BranchID] = sps
+	}
+	branchIDs := slices.Sorted(maps.Keys(byBranch))
+
+	served := func(sps *models.TflAPIPresentationEntitiesStopPointSequence) []string {
+		var seq []string
+		for _, sp := range sps.StopPoint {
+			if tr.serves(sp.ID) {
+				seq = append(seq, sp.ID)
+			}
+		}
+		return seq
+	}
+
+	for _, id := range branchIDs {
+		seq := served(byBranch[id])
+		tr.stopGraph.addSequence(seq)
+
+		// Join the end of this branch to the start of each following branch.
+		if len(seq) == 0 {
+			continue
+		}
+		for _, next := range byBranch[id].NextBranchIds {
+			nextSps, ok := byBranch[next]
+			if !ok {
+				continue
+			}
+			if nextSeq := served(nextSps); len(nextSeq) > 0 {
+				tr.stopGraph.addSequence([]string{seq[len(seq)-1], nextSeq[0]})
+			}
+		}
+	}
+	tr.orderStops()
+}
+
+// serves reports whether any of the route's station intervals calls at
+// stopID.
+func (tr *TimetableRenderer) serves(stopID string) bool {
+	for _, offsets := range tr.intervalData {
+		if _, ok := offsets[stopID]; ok {
+			return true
+		}
+	}
+	return false
 }
 
-func (tr *TimetableRenderer) RenderAsText(maxJourneys int, stationColWidth int) string {
+// orderStops recomputes the rendered stop order and branch labels from the
+// stop graph.
+func (tr *TimetableRenderer) orderStops() {
+	depID := tr.timetable.Timetable.DepartureStopID
+	ordered := tr.stopGraph.order(depID)
+	branchOf := tr.stopGraph.branches(ordered)
+
+	// Name each branch after its furthest stop.
+	branchEnd := make(map[string]string)
+	for _, id := range ordered {
+		if head, ok := branchOf[id]; ok {
+			branchEnd[head] = id
+		}
+	}
+
+	tr.stops = tr.stops[:0]
+	for _, id := range ordered {
+		s := stopInfo{id: id, name: tr.stationNames[id]}
+		if head, ok := branchOf[id]; ok {
+			s.branch = "Branch to " + tr.stationNames[branchEnd[head]]
+		}
+		tr.stops = append(tr.stops, s)
+	}
+}
+
+// RenderAsText renders the selected page, or every page if none is selected,
+// as fixed-width text tables of at most journeysPerPage journeys each.
+func (tr *TimetableRenderer) RenderAsText(journeysPerPage int, stationColWidth int) string {
 	var sb strings.Builder
 	fmt.Fprintf(&sb, "Timetable for %s at %s\n\n", tr.timetable.LineName, tr.timetable.Timetable.DepartureStopID)
 	fmt.Fprintf(&sb, "Schedule: %s\n", tr.schedule.Name)
+	if summary := tr.PeriodSummary(); len(summary) > 0 {
+		for _, line := range summary {
+			fmt.Fprintf(&sb, "  %s\n", line)
+		}
+		sb.WriteString("\n")
+	}
 
-	journeys := tr.schedule.KnownJourneys
-	if maxJourneys > 0 && len(journeys) > maxJourneys {
-		journeys = journeys[:maxJourneys]
+	notes := tr.destinationNotes()
+	blocks := tr.blocks(journeysPerPage)
+	for i, block := range blocks {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		tr.writeTextTable(&sb, tr.columns(block), notes, stationColWidth)
+	}
+
+	if used := tr.usedNotes(notes, blocks); len(used) > 0 {
+		sb.WriteString("\nNotes\n")
+		for _, n := range used {
+			fmt.Fprintf(&sb, "  %s  Terminates at %s\n", n.mark, n.name)
+		}
 	}
 
-	// Header
+	sb.WriteString("\nFirst and last trains\n")
+	sb.WriteString(tr.RenderFirstLastText(stationColWidth))
+
+	return sb.String()
+}
+
+func (tr *TimetableRenderer) writeTextTable(sb *strings.Builder, columns []timetableColumn, notes map[string]destinationNote, stationColWidth int) {
+	// Header: departure time, then destination
 	const colWidth = 10
-	fmt.Fprintf(&sb, "%-*s", stationColWidth, "Station")
-	for i := range journeys {
-		fmt.Fprintf(&sb, " | %-*s", colWidth, fmt.Sprintf("Train %d", i+1))
+	fmt.Fprintf(sb, "%-*s", stationColWidth, "Station")
+	for _, c := range columns {
+		if c.journey == nil {
+			fmt.Fprintf(sb, " | %-*s", colWidth, fmt.Sprintf("every %dm", c.every))
+			continue
+		}
+		label := journeyDeparture(c.journey).Format(tr.timeFormat)
+		if note, ok := notes[tr.journeyDestination(c.journey)]; ok {
+			label += " " + note.mark
+		}
+		fmt.Fprintf(sb, " | %-*s", colWidth, label)
 	}
-	fmt.Fprint(&sb, "\n")
-	fmt.Fprint(&sb, strings.Repeat("-", stationColWidth+len(journeys)*(colWidth+3)))
-	fmt.Fprint(&sb, "\n")
+	fmt.Fprint(sb, "\n")
+	fmt.Fprintf(sb, "%-*s", stationColWidth, "")
+	for _, c := range columns {
+		dest := ""
+		if c.journey != nil {
+			dest = shortStationName(tr.stationNames[tr.journeyDestination(c.journey)])
+			if len(dest) > colWidth {
+				dest = dest[:colWidth]
+			}
+		}
+		fmt.Fprintf(sb, " | %-*s", colWidth, dest)
+	}
+	fmt.Fprint(sb, "\n")
+	fmt.Fprint(sb, strings.Repeat("-", stationColWidth+len(columns)*(colWidth+3)))
+	fmt.Fprint(sb, "\n")
 
 	// Rows
+	branch := ""
 	for _, s := range tr.stops {
+		if s.branch != branch {
+			branch = s.branch
+			if branch != "" {
+				fmt.Fprintf(sb, "-- %s --\n", branch)
+			}
+		}
 		name := s.name
 		if len(name) > stationColWidth {
 			name = name[:stationColWidth-3] + "..."
 		}
-		fmt.Fprintf(&sb, "%-*s", stationColWidth, name)
+		fmt.Fprintf(sb, "%-*s", stationColWidth, name)
 
-		for _, j := range journeys {
-			offsets, ok := tr.intervalData[j.IntervalID]
-			if !ok {
-				if len(tr.targetRoute.StationIntervals) > 0 {
-					id64, _ := strconv.ParseInt(tr.targetRoute.StationIntervals[0].ID, 10, 32)
-					offsets = tr.intervalData[int32(id64)]
-					ok = true
-				}
+		for _, c := range columns {
+			j := c.journey
+			if j == nil {
+				fmt.Fprintf(sb, " | %-*s", colWidth, "...")
+				continue
 			}
-
+			offsets, ok := tr.journeyOffsets(j)
 			if ok {
 				off, found := offsets[s.id]
 				if found {
 					arrTime := calculateArrivalTime(j.Hour, j.Minute, off)
-					fmt.Fprintf(&sb, " | %-*s", colWidth, arrTime)
+					fmt.Fprintf(sb, " | %-*s", colWidth, arrTime.Format(tr.timeFormat))
 				} else {
-					fmt.Fprintf(&sb, " | %-*s", colWidth, "---")
+					fmt.Fprintf(sb, " | %-*s", colWidth, "---")
 				}
 			} else {
-				fmt.Fprintf(&sb, " | %-*s", colWidth, "err")
+				fmt.Fprintf(sb, " | %-*s", colWidth, "err")
 			}
 		}
 		sb.WriteString("\n")
 	}
+}
 
-	return sb.String()
+// SetTimeFormat sets how times are rendered by RenderAsText and timetableView.
+func (tr *TimetableRenderer) SetTimeFormat(f TimeFormat) {
+	tr.timeFormat = f
+}
+
+// TimetableCSS styles the "timetable" partial. Pages embedding the table
+// should include it in their <head>.
+const TimetableCSS = `ul.periods { font-family: sans-serif; font-size: 0.9em; color: #444; }
+.timetable-scroll { overflow: auto; max-height: 80vh; }
+table.timetable { border-collapse: separate; border-spacing: 0; font-family: sans-serif; font-size: 0.9em; }
+table.timetable th, table.timetable td { border-bottom: 1px solid #ddd; padding: 4px 8px; white-space: nowrap; text-align: center; }
+table.timetable thead th { position: sticky; top: 0; background-color: #f2f2f2; z-index: 1; }
+table.timetable th.station { position: sticky; left: 0; text-align: left; background-color: #fff; }
+table.timetable thead th.station { background-color: #f2f2f2; z-index: 2; }
+table.timetable tbody tr:nth-child(even) td, table.timetable tbody tr:nth-child(even) th.station { background-color: #f7f7f7; }
+table.timetable td.no-call { color: #bbb; }
+.timetable-scroll + .timetable-scroll { margin-top: 1em; }
+table.timetable .destination { font-weight: normal; font-size: 0.85em; }
+table.timetable th.short { color: #9b0056; }
+dl.notes { font-family: sans-serif; font-size: 0.9em; display: grid; grid-template-columns: max-content auto; gap: 2px 8px; }
+dl.notes dt { font-weight: bold; color: #9b0056; }
+dl.notes dd { margin: 0; }
+table.first-last { margin-top: 1em; }
+table.first-last caption { text-align: left; font-weight: bold; padding: 4px 0; }
+table.timetable .fold { color: #666; font-style: italic; white-space: normal; min-width: 6em; }
+table.timetable tbody.branch th.station { border-left: 4px solid #9b0056; }
+table.timetable tr.branch-heading th.station { font-style: italic; background-color: #fff; }
+table.timetable .live { font-size: 0.8em; font-weight: bold; }
+table.timetable .live.on-time { color: #00782a; }
+table.timetable .live.late { color: #b35900; }
+table.timetable .live.cancelled { color: #dc241f; }
+table.timetable tr.disrupted th.station, table.timetable tbody tr.disrupted:nth-child(even) th.station { background-color: #fde8e8; box-shadow: inset 4px 0 #dc241f; }
+table.timetable tr.disrupted td { color: #a61c17; }
+.disruption-banner { font-family: sans-serif; background-color: #fde8e8; border-left: 6px solid #dc241f; padding: 4px 12px; margin-bottom: 1em; }
+.disruption-banner h2 { font-size: 1em; margin: 0.5em 0 0.2em; }
+.disruption-banner p { margin: 0.2em 0; }
+.disruption-banner .affected { font-size: 0.9em; color: #444; }
+`
+
+// timetableView is the data of the "timetable" partial: the schedule's
+// periods, its tables, the footnotes they use and the first and last trains.
+type timetableView struct {
+	Periods   []string
+	Tables    []timetableTable
+	Notes     []footnote
+	FirstLast []firstLastRow
+}
+
+// timetableTable is one block of journeys, with a row group per branch.
+type timetableTable struct {
+	Columns   []timetableColumnHeading
+	RowGroups []timetableRowGroup
+}
+
+// Width returns the number of columns of t, including the station column.
+func (t timetableTable) Width() int {
+	return len(t.Columns) + 1
+}
+
+// timetableColumnHeading heads a journey column, or a fold of regular
+// journeys if Every is set. Mark is the destination's footnote mark, and
+// Live the journey's live status, if any.
+type timetableColumnHeading struct {
+	Every       int
+	Departs     string
+	Destination string
+	Mark        string
+	Live        *liveBadge
+}
+
+// liveBadge shows a journey's live status.
+type liveBadge struct {
+	Class string
+	Text  string
+}
+
+// timetableRowGroup is the rows of a branch, or of the trunk if Branch is
+// empty.
+type timetableRowGroup struct {
+	Branch string
+	Rows   []timetableRow
 }
 
-func (tr *TimetableRenderer) RenderAsHtml(maxJourneys int) string {
-	// TODO: Implement HTML rendering
-	return "<html><body>HTML rendering not implemented yet</body></html>"
+// timetableRow is a stop's times. Disrupted marks stops affected by a
+// disruption.
+type timetableRow struct {
+	Station   string
+	Disrupted bool
+	Cells     []timetableCell
 }
 
-func calculateArrivalTime(hour, minute string, offsetMinutes float64) string {
-	h := 0
-	fmt.Sscanf(hour, "%d", &h)
-	m := 0
-	fmt.Sscanf(minute, "%d", &m)
+// timetableCell is a time, or a placeholder with a class and title.
+type timetableCell struct {
+	Class string
+	Title string
+	Text  string
+}
+
+// timetableView returns the selected page, or every page if none is
+// selected, as tables of at most journeysPerPage journeys each.
+func (tr *TimetableRenderer) timetableView(journeysPerPage int) timetableView {
+	v := timetableView{
+		Periods:   tr.PeriodSummary(),
+		FirstLast: tr.firstLastRows(),
+	}
+	notes := tr.destinationNotes()
+	blocks := tr.blocks(journeysPerPage)
+	for _, block := range blocks {
+		v.Tables = append(v.Tables, tr.htmlTable(tr.columns(block), notes))
+	}
+	for _, n := range tr.usedNotes(notes, blocks) {
+		v.Notes = append(v.Notes, footnote{Mark: n.mark, Destination: n.name})
+	}
+	return v
+}
+
+func (tr *TimetableRenderer) htmlTable(columns []timetableColumn, notes map[string]destinationNote) timetableTable {
+	var t timetableTable
+	for _, c := range columns {
+		if c.journey == nil {
+			t.Columns = append(t.Columns, timetableColumnHeading{Every: c.every})
+			continue
+		}
+		dest := tr.journeyDestination(c.journey)
+		heading := timetableColumnHeading{
+			Departs:     journeyDeparture(c.journey).Format(tr.timeFormat),
+			Destination: shortStationName(tr.stationNames[dest]),
+			Mark:        notes[dest].mark,
+		}
+		if status, ok := tr.live[c.journey]; ok {
+			heading.Live = &liveBadge{Class: status.htmlClass(), Text: status.String()}
+		}
+		t.Columns = append(t.Columns, heading)
+	}
 
-	totalMinutes := h*60 + m + int(offsetMinutes)
-	newH := (totalMinutes / 60) % 24
-	newM := totalMinutes % 60
+	for i, s := range tr.stops {
+		if i == 0 || s.branch != tr.stops[i-1].branch {
+			t.RowGroups = append(t.RowGroups, timetableRowGroup{Branch: s.branch})
+		}
+		row := timetableRow{Station: s.name, Disrupted: tr.disrupted[s.id]}
+		for _, c := range columns {
+			j := c.journey
+			if j == nil {
+				row.Cells = append(row.Cells, timetableCell{Class: "fold", Text: "…"})
+				continue
+			}
+			offsets, ok := tr.journeyOffsets(j)
+			if !ok {
+				row.Cells = append(row.Cells, timetableCell{Class: "error", Text: "err"})
+				continue
+			}
+			off, found := offsets[s.id]
+			if !found {
+				row.Cells = append(row.Cells, timetableCell{Class: "no-call", Title: "Does not call", Text: "---"})
+				continue
+			}
+			row.Cells = append(row.Cells, timetableCell{Text: calculateArrivalTime(j.Hour, j.Minute, off).Format(tr.timeFormat)})
+		}
+		group := &t.RowGroups[len(t.RowGroups)-1]
+		group.Rows = append(group.Rows, row)
+	}
+	return t
+}
+
+// journeyOffsets returns the stop offsets for the journey's station interval,
+// falling back to the route's first interval when the journey's is unknown.
+func (tr *TimetableRenderer) journeyOffsets(j *models.TflAPIPresentationEntitiesKnownJourney) (map[string]float64, bool) {
+	offsets, ok := tr.intervalData[j.IntervalID]
+	if !ok && len(tr.targetRoute.StationIntervals) > 0 {
+		id64, _ := strconv.ParseInt(tr.targetRoute.StationIntervals[0].ID, 10, 32)
+		offsets, ok = tr.intervalData[int32(id64)]
+	}
+	return offsets, ok
+}
 
-	return fmt.Sprintf("%02d:%02d", newH, newM)
+func calculateArrivalTime(hour, minute string, offsetMinutes float64) ServiceTime {
+	return parseServiceTime(hour, minute).AddMinutes(offsetMinutes)
 }